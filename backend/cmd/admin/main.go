@@ -0,0 +1,172 @@
+// Command admin manages user accounts from the shell:
+//
+//	go run ./cmd/admin create-user -name "Sara" -email sara@example.com -role purchaser
+//	go run ./cmd/admin reset-password -email sara@example.com
+//	go run ./cmd/admin set-role -email sara@example.com -role manager
+//
+// When -password is omitted a random one is generated and printed. Every
+// change is written to the audit log with no actor, as made by the server.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/db"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: admin <create-user|reset-password|set-role> [flags]")
+	fmt.Fprintln(os.Stderr, "run 'admin <command> -h' for the flags of a command")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	dbPath := fs.String("db", "./data/app.db", "path to the SQLite database")
+	email := fs.String("email", "", "user email (required)")
+
+	switch cmd {
+	case "create-user":
+		name := fs.String("name", "", "display name (required)")
+		role := fs.String("role", auth.RoleViewer, "role: "+roleList())
+		password := fs.String("password", "", "password (generated when empty)")
+		fs.Parse(args)
+		requireFlag(fs, "email", *email)
+		requireFlag(fs, "name", *name)
+
+		conn := open(*dbPath)
+		defer conn.Close()
+
+		pw := passwordOrRandom(*password)
+		var id string
+		err := audited(conn, audit.Create, func(tx *sql.Tx) (*audit.Change, error) {
+			var err error
+			id, err = auth.CreateUser(tx, *name, *email, pw, *role)
+			return audit.Inserted("users", "id = ?", id), err
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Created user:", *email, "id:", id, "role:", *role)
+		if *password == "" {
+			log.Println("Temporary password:", pw)
+		}
+
+	case "reset-password":
+		password := fs.String("password", "", "new password (generated when empty)")
+		fs.Parse(args)
+		requireFlag(fs, "email", *email)
+
+		conn := open(*dbPath)
+		defer conn.Close()
+
+		id := userID(conn, *email)
+		pw := passwordOrRandom(*password)
+		err := audited(conn, "password", func(tx *sql.Tx) (*audit.Change, error) {
+			change := audit.Track(tx, "users", "id = ?", id)
+			return change, auth.SetPassword(tx, id, pw)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Password reset for:", *email, "(all sessions revoked)")
+		if *password == "" {
+			log.Println("Temporary password:", pw)
+		}
+
+	case "set-role":
+		role := fs.String("role", "", "role: "+roleList()+" (required)")
+		fs.Parse(args)
+		requireFlag(fs, "email", *email)
+		requireFlag(fs, "role", *role)
+
+		conn := open(*dbPath)
+		defer conn.Close()
+
+		id := userID(conn, *email)
+		err := audited(conn, audit.Update, func(tx *sql.Tx) (*audit.Change, error) {
+			change := audit.Track(tx, "users", "id = ?", id)
+			return change, auth.SetRole(tx, id, *role)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Role of", *email, "set to", *role)
+
+	default:
+		usage()
+	}
+}
+
+func open(dbPath string) *sql.DB {
+	_ = os.MkdirAll(filepath.Dir(dbPath), 0755)
+
+	conn, err := db.Open(dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Ensure migrations applied (safe)
+	if err := db.ApplyMigrations(conn, "./migrations"); err != nil {
+		log.Fatal(err)
+	}
+	return conn
+}
+
+// audited runs change in a transaction and logs the row it returns in the
+// same transaction.
+func audited(conn *sql.DB, action string, change func(tx *sql.Tx) (*audit.Change, error)) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	c, err := change(tx)
+	if err != nil {
+		return err
+	}
+	if err := c.Record(tx, audit.Actor{}, action); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func userID(conn *sql.DB, email string) string {
+	id, err := auth.UserIDByEmail(conn, email)
+	if err != nil {
+		log.Fatal(err, ": ", email)
+	}
+	return id
+}
+
+func requireFlag(fs *flag.FlagSet, name, value string) {
+	if value == "" {
+		fmt.Fprintf(os.Stderr, "-%s is required\n", name)
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func passwordOrRandom(pw string) string {
+	if pw == "" {
+		return auth.RandomPassword()
+	}
+	return pw
+}
+
+func roleList() string {
+	return strings.Join([]string{auth.RoleAdmin, auth.RoleManager, auth.RolePurchaser, auth.RoleViewer}, ", ")
+}
@@ -5,11 +5,18 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
+	_ "time/tzdata"
 
+	"almanarteen-backend/internal/alerts"
 	"almanarteen-backend/internal/auth"
 	"almanarteen-backend/internal/db"
 	"almanarteen-backend/internal/handlers"
 	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/notify"
+	"almanarteen-backend/internal/prices"
+	"almanarteen-backend/internal/recurring"
+	"almanarteen-backend/internal/storage"
 )
 
 func main() {
@@ -26,9 +33,61 @@ func main() {
 		log.Fatal(err)
 	}
 
-	ah := handlers.AuthHandler{DB: conn}
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:3000"
+	}
+
+	httpx.TrustProxy = os.Getenv("TRUST_PROXY") == "1"
+	sessions := auth.SessionPolicyFromEnv()
+
+	go auth.RunJanitor(conn, time.Hour)
+
+	notifier := notify.FromEnv()
+
+	// Budget alerts are always kept in-app; email goes out unless
+	// ALERT_EMAIL=0, and ALERT_WEBHOOK_URL adds a webhook.
+	budgetAlerts := &alerts.Evaluator{DB: conn, AppURL: appURL}
+	if os.Getenv("ALERT_EMAIL") != "0" {
+		budgetAlerts.Email = notifier
+	}
+	if u := os.Getenv("ALERT_WEBHOOK_URL"); u != "" {
+		budgetAlerts.Webhook = notify.Webhook{URL: u}
+	}
+
+	ah := handlers.AuthHandler{
+		DB:       conn,
+		Throttle: auth.NewThrottle(conn),
+		MFA:      auth.NewMFA(conn, "Almanarteen"),
+		Sessions: sessions,
+		Notifier: notifier,
+		AppURL:   appURL,
+	}
 	ch := handlers.CatalogHandler{DB: conn}
-	eh := handlers.ExpensesHandler{DB: conn}
+	eh := handlers.ExpensesHandler{
+		DB:     conn,
+		Files:  storage.Local{Dir: "./data/attachments"},
+		Alerts: budgetAlerts,
+		Prices: prices.PolicyFromEnv(),
+	}
+	alh := handlers.AlertsHandler{DB: conn}
+	// Recurring expenses fall due at midnight in BUSINESS_TZ.
+	tz := os.Getenv("BUSINESS_TZ")
+	if tz == "" {
+		tz = "Asia/Bahrain"
+	}
+	if recurring.Location, err = time.LoadLocation(tz); err != nil {
+		log.Fatal(err)
+	}
+	scheduler := &recurring.Scheduler{DB: conn, Alerts: budgetAlerts}
+	go scheduler.Run(time.Hour)
+	reh := handlers.RecurringHandler{DB: conn, Scheduler: scheduler}
+	uh := handlers.UsersHandler{DB: conn}
+	rh := handlers.ReportsHandler{DB: conn}
+	ph := handlers.PeriodsHandler{DB: conn}
+	audh := handlers.AuditHandler{DB: conn}
+
+	g := auth.Guard{DB: conn, Sessions: sessions}
 
 	mux := http.NewServeMux()
 
@@ -38,30 +97,91 @@ func main() {
 
 	// public
 	mux.HandleFunc("/auth/login", ah.Login)
+	mux.HandleFunc("POST /auth/login/mfa", ah.LoginMFA)
+	mux.HandleFunc("POST /auth/password/forgot", ah.ForgotPassword)
+	mux.HandleFunc("POST /auth/password/reset", ah.ResetPassword)
 
 	// protected
-	mux.Handle("/auth/me", auth.RequireAdmin(conn, http.HandlerFunc(ah.Me)))
-	mux.Handle("/auth/logout", auth.RequireAdmin(conn, http.HandlerFunc(ah.Logout)))
+	mux.Handle("/auth/me", g.Authenticated(http.HandlerFunc(ah.Me)))
+	mux.Handle("/auth/logout", g.Authenticated(http.HandlerFunc(ah.Logout)))
+
+	// account settings (browser sessions only, not API tokens)
+	mux.Handle("POST /auth/logout-all", g.SessionOnly(http.HandlerFunc(ah.LogoutAll)))
+	mux.Handle("GET /auth/sessions", g.SessionOnly(http.HandlerFunc(ah.ListSessions)))
+	mux.Handle("DELETE /auth/sessions/{id}", g.SessionOnly(http.HandlerFunc(ah.RevokeSession)))
+	mux.Handle("POST /auth/password", g.SessionOnly(http.HandlerFunc(ah.ChangePassword)))
+	mux.Handle("POST /auth/mfa/enroll", g.SessionOnly(http.HandlerFunc(ah.EnrollMFA)))
+	mux.Handle("POST /auth/mfa/confirm", g.SessionOnly(http.HandlerFunc(ah.ConfirmMFA)))
+	mux.Handle("POST /auth/mfa/disable", g.SessionOnly(http.HandlerFunc(ah.DisableMFA)))
+	mux.Handle("GET /auth/tokens", g.SessionOnly(http.HandlerFunc(ah.ListAPITokens)))
+	mux.Handle("POST /auth/tokens", g.SessionOnly(http.HandlerFunc(ah.CreateAPIToken)))
+	mux.Handle("DELETE /auth/tokens/{id}", g.SessionOnly(http.HandlerFunc(ah.RevokeAPIToken)))
 
 	// catalog (protected)
-	mux.Handle("/categories", auth.RequireAdmin(conn, http.HandlerFunc(ch.Categories)))
-	mux.Handle("/items", auth.RequireAdmin(conn, http.HandlerFunc(ch.Items)))
+	mux.Handle("GET /categories", g.Require(auth.PermCatalogRead, http.HandlerFunc(ch.Categories)))
+	mux.Handle("POST /categories", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.CreateCategory)))
+	mux.Handle("PATCH /categories/{id}", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.UpdateCategory)))
+	mux.Handle("DELETE /categories/{id}", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.DeleteCategory)))
+	mux.Handle("GET /items", g.Require(auth.PermCatalogRead, http.HandlerFunc(ch.Items)))
+	mux.Handle("POST /items", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.CreateItem)))
+	mux.Handle("PATCH /items/{id}", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.UpdateItem)))
+	mux.Handle("DELETE /items/{id}", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.DeleteItem)))
+	mux.Handle("GET /items/{id}/packs", g.Require(auth.PermCatalogRead, http.HandlerFunc(ch.ItemPacks)))
+	mux.Handle("POST /items/{id}/packs", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.CreateItemPack)))
+	mux.Handle("DELETE /items/{id}/packs/{packId}", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.DeleteItemPack)))
+	mux.Handle("GET /units", g.Require(auth.PermCatalogRead, http.HandlerFunc(ch.Units)))
+	mux.Handle("GET /items/{id}/prices", g.Require(auth.PermReportsRead, http.HandlerFunc(rh.PriceHistory)))
+	mux.Handle("GET /suppliers", g.Require(auth.PermCatalogRead, http.HandlerFunc(ch.Suppliers)))
+	mux.Handle("POST /suppliers", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.CreateSupplier)))
+	mux.Handle("GET /suppliers/{id}", g.Require(auth.PermCatalogRead, http.HandlerFunc(ch.GetSupplier)))
+	mux.Handle("PATCH /suppliers/{id}", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.UpdateSupplier)))
+	mux.Handle("DELETE /suppliers/{id}", g.Require(auth.PermCatalogWrite, http.HandlerFunc(ch.DeleteSupplier)))
 
 	// expenses (protected)
-	mux.Handle("/expenses", auth.RequireAdmin(conn, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "POST" {
-			eh.CreateExpense(w, r)
-			return
-		}
-		if r.Method == "GET" {
-			eh.ListExpenses(w, r)
-			return
-		}
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-	})))
-
-	mux.Handle("/budget", auth.RequireAdmin(conn, http.HandlerFunc(eh.SetBudget)))
-	mux.Handle("/dashboard/summary", auth.RequireAdmin(conn, http.HandlerFunc(eh.Summary)))
+	mux.Handle("GET /expenses", g.Require(auth.PermExpensesRead, http.HandlerFunc(eh.ListExpenses)))
+	mux.Handle("POST /expenses", g.Require(auth.PermExpensesWrite, http.HandlerFunc(eh.CreateExpense)))
+	mux.Handle("POST /expenses/import", g.Require(auth.PermExpensesWrite, http.HandlerFunc(eh.ImportExpenses)))
+	mux.Handle("GET /expenses/export", g.Require(auth.PermReportsRead, http.HandlerFunc(eh.ExportExpenses)))
+	mux.Handle("GET /expenses/{id}", g.Require(auth.PermExpensesRead, http.HandlerFunc(eh.GetExpense)))
+	mux.Handle("PUT /expenses/{id}", g.Require(auth.PermExpensesWrite, http.HandlerFunc(eh.UpdateExpense)))
+	mux.Handle("PATCH /expenses/{id}", g.Require(auth.PermExpensesWrite, http.HandlerFunc(eh.UpdateExpense)))
+	mux.Handle("DELETE /expenses/{id}", g.Require(auth.PermExpensesWrite, http.HandlerFunc(eh.DeleteExpense)))
+	mux.Handle("GET /expenses/{id}/attachments", g.Require(auth.PermExpensesRead, http.HandlerFunc(eh.ListAttachments)))
+	mux.Handle("POST /expenses/{id}/attachments", g.Require(auth.PermExpensesWrite, http.HandlerFunc(eh.UploadAttachment)))
+	mux.Handle("GET /expenses/{id}/attachments/{attachmentId}", g.Require(auth.PermExpensesRead, http.HandlerFunc(eh.DownloadAttachment)))
+	mux.Handle("DELETE /expenses/{id}/attachments/{attachmentId}", g.Require(auth.PermExpensesWrite, http.HandlerFunc(eh.DeleteAttachment)))
+
+	mux.Handle("GET /recurring", g.Require(auth.PermExpensesRead, http.HandlerFunc(reh.ListRecurring)))
+	mux.Handle("POST /recurring", g.Require(auth.PermExpensesWrite, http.HandlerFunc(reh.CreateRecurring)))
+	mux.Handle("GET /recurring/{id}", g.Require(auth.PermExpensesRead, http.HandlerFunc(reh.GetRecurring)))
+	mux.Handle("PATCH /recurring/{id}", g.Require(auth.PermExpensesWrite, http.HandlerFunc(reh.UpdateRecurring)))
+	mux.Handle("DELETE /recurring/{id}", g.Require(auth.PermExpensesWrite, http.HandlerFunc(reh.DeleteRecurring)))
+	mux.Handle("POST /recurring/{id}/pause", g.Require(auth.PermExpensesWrite, http.HandlerFunc(reh.PauseRecurring)))
+	mux.Handle("POST /recurring/{id}/resume", g.Require(auth.PermExpensesWrite, http.HandlerFunc(reh.ResumeRecurring)))
+	mux.Handle("GET /recurring/{id}/preview", g.Require(auth.PermExpensesRead, http.HandlerFunc(reh.PreviewRecurring)))
+
+	mux.Handle("POST /budget", g.Require(auth.PermBudgetsWrite, http.HandlerFunc(eh.SetBudget)))
+	mux.Handle("DELETE /budget", g.Require(auth.PermBudgetsWrite, http.HandlerFunc(eh.DeleteBudget)))
+	mux.Handle("GET /alerts", g.Require(auth.PermReportsRead, http.HandlerFunc(alh.ListAlerts)))
+	mux.Handle("POST /alerts/{id}/acknowledge", g.Require(auth.PermBudgetsWrite, http.HandlerFunc(alh.AcknowledgeAlert)))
+	mux.Handle("GET /alerts/thresholds", g.Require(auth.PermReportsRead, http.HandlerFunc(alh.Thresholds)))
+	mux.Handle("PUT /alerts/thresholds", g.Require(auth.PermBudgetsWrite, http.HandlerFunc(alh.SetThresholds)))
+	mux.Handle("GET /periods", g.Require(auth.PermReportsRead, http.HandlerFunc(ph.ListPeriods)))
+	mux.Handle("POST /periods/{month}/close", g.Require(auth.PermPeriodsClose, http.HandlerFunc(ph.ClosePeriod)))
+	mux.Handle("POST /periods/{month}/reopen", g.Require(auth.PermPeriodsReopen, http.HandlerFunc(ph.ReopenPeriod)))
+	mux.Handle("GET /dashboard/summary", g.Require(auth.PermReportsRead, http.HandlerFunc(eh.Summary)))
+	mux.Handle("GET /reports/vat", g.Require(auth.PermReportsRead, http.HandlerFunc(rh.VATReport)))
+	mux.Handle("GET /reports/trends", g.Require(auth.PermReportsRead, http.HandlerFunc(rh.Trends)))
+
+	// users (protected)
+	mux.Handle("GET /users", g.Require(auth.PermUsersManage, http.HandlerFunc(uh.ListUsers)))
+	mux.Handle("POST /users", g.Require(auth.PermUsersManage, http.HandlerFunc(uh.CreateUser)))
+	mux.Handle("PATCH /users/{id}", g.Require(auth.PermUsersManage, http.HandlerFunc(uh.UpdateUser)))
+	mux.Handle("POST /users/{id}/deactivate", g.Require(auth.PermUsersManage, http.HandlerFunc(uh.DeactivateUser)))
+	mux.Handle("POST /users/{id}/activate", g.Require(auth.PermUsersManage, http.HandlerFunc(uh.ActivateUser)))
+	mux.Handle("POST /users/{id}/unlock", g.Require(auth.PermUsersManage, http.HandlerFunc(uh.UnlockUser)))
+
+	mux.Handle("GET /audit", g.Require(auth.PermAuditRead, http.HandlerFunc(audh.ListAudit)))
 
 	// Exact allowed origins:
 	allowedExact := []string{
@@ -69,8 +189,13 @@ func main() {
 		"https://almanarteen-t13d.vercel.app", // production domain
 	}
 
-	// Allow any vercel preview domain that starts with this prefix:
-	vercelProjectPrefix := "almanarteen-t13d"
+	// Allow any vercel preview domain that starts with this prefix.
+	// Anyone can name a Vercel project with this prefix, and a trusted origin
+	// can read responses (CSRF token included), so previews are opt-in.
+	vercelProjectPrefix := ""
+	if os.Getenv("CORS_ALLOW_PREVIEWS") == "1" {
+		vercelProjectPrefix = "almanarteen-t13d"
+	}
 
 	handler := httpx.CORS(allowedExact, vercelProjectPrefix, mux)
 
@@ -0,0 +1,112 @@
+// Command import loads historical expenses from a CSV file:
+//
+//	go run ./cmd/import -file purchases-2024.csv -email sara@example.com
+//	go run ./cmd/import -file purchases-2024.csv -email sara@example.com -create-missing -commit
+//
+// Without -commit it is a dry run that only reports problems. Columns are
+// detected from the header (date, category, item, unit, quantity, unit price,
+// note); -map overrides that, e.g. -map "item=Product,unitPrice=Price BD".
+//
+// As with cmd/admin, every change is written to the audit log with no actor,
+// as made by the server; -email only says who the expenses belong to.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/db"
+	"almanarteen-backend/internal/importer"
+)
+
+func main() {
+	dbPath := flag.String("db", "./data/app.db", "path to the SQLite database")
+	file := flag.String("file", "", "CSV file to import (required)")
+	email := flag.String("email", "", "user the expenses are recorded against (required)")
+	commit := flag.Bool("commit", false, "save the rows; without it nothing is written")
+	createMissing := flag.Bool("create-missing", false, "create unknown categories and items")
+	mapping := flag.String("map", "", "column overrides as field=Header pairs, comma separated")
+	asJSON := flag.Bool("json", false, "print the result as JSON")
+	flag.Parse()
+
+	if *file == "" || *email == "" {
+		fmt.Fprintln(os.Stderr, "-file and -email are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	columns := map[string]string{}
+	if *mapping != "" {
+		for _, pair := range strings.Split(*mapping, ",") {
+			field, header, ok := strings.Cut(pair, "=")
+			if !ok {
+				log.Fatalf("bad -map entry %q, want field=Header", pair)
+			}
+			columns[strings.TrimSpace(field)] = strings.TrimSpace(header)
+		}
+	}
+
+	conn, err := db.Open(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	if err := db.ApplyMigrations(conn, "./migrations"); err != nil {
+		log.Fatal(err)
+	}
+
+	userID, err := auth.UserIDByEmail(conn, *email)
+	if err != nil {
+		log.Fatal(err, ": ", *email)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	res, err := importer.Import(conn, f, importer.Options{
+		CreatedBy:     userID,
+		Actor:         audit.Actor{},
+		CreateMissing: *createMissing,
+		DryRun:        !*commit,
+		Columns:       columns,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(res)
+	} else {
+		for _, e := range res.Errors {
+			fmt.Printf("line %d: %s\n", e.Row, e.Error)
+		}
+		for _, c := range res.CreatedCategories {
+			fmt.Println("new category:", c)
+		}
+		for _, it := range res.CreatedItems {
+			fmt.Println("new item:", it)
+		}
+		fmt.Printf("%d rows, %d valid, total %s BD\n", res.Rows, res.Valid, res.Total)
+	}
+
+	switch {
+	case res.Committed:
+		log.Printf("Imported %d expenses", res.Imported)
+	case len(res.Errors) > 0:
+		log.Printf("Nothing imported: fix the %d rows above and run again", len(res.Errors))
+		os.Exit(1)
+	default:
+		log.Println("Dry run: nothing imported; run again with -commit to save")
+	}
+}
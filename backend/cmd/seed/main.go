@@ -7,9 +7,9 @@ import (
 	"path/filepath"
 	"time"
 
+	"almanarteen-backend/internal/auth"
 	"almanarteen-backend/internal/db"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Category struct {
@@ -68,16 +68,7 @@ func seedAdmin(conn *sql.DB, name, email, password string) {
 		return
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	_, err = conn.Exec(`
-		INSERT INTO users (id, name, email, password_hash, role)
-		VALUES (?, ?, ?, ?, 'admin')
-	`, uuid.NewString(), name, email, string(hash))
-	if err != nil {
+	if _, err := auth.CreateUser(conn, name, email, password, auth.RoleAdmin); err != nil {
 		log.Fatal(err)
 	}
 	log.Println("Seeded admin:", email, "password:", password)
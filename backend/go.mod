@@ -3,7 +3,7 @@ module almanarteen-backend
 go 1.24.2
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/mattn/go-sqlite3 v1.14.33 // indirect
-	golang.org/x/crypto v0.46.0 // indirect
+	github.com/google/uuid v1.6.0
+	github.com/mattn/go-sqlite3 v1.14.33
+	golang.org/x/crypto v0.46.0
 )
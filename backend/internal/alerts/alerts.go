@@ -0,0 +1,233 @@
+// Package alerts warns when spending crosses a configured percentage of a
+// monthly or category budget. Each crossing is recorded in budget_alerts so
+// it fires once per budget amount, and the same rows serve as in-app
+// notifications.
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/money"
+	"almanarteen-backend/internal/notify"
+
+	"github.com/google/uuid"
+)
+
+// Evaluator checks budgets after spending changes. A nil *Evaluator does
+// nothing, so handlers can call it unconditionally.
+type Evaluator struct {
+	DB *sql.DB
+	// Email is sent to every active user who can manage budgets; nil
+	// disables it.
+	Email notify.Notifier
+	// Webhook receives one message per alert; nil disables it.
+	Webhook notify.Notifier
+	AppURL  string
+}
+
+// ForExpense re-checks, in the background, the month of date (YYYY-MM-DD)
+// overall and for the category of itemID.
+func (e *Evaluator) ForExpense(date, itemID string) {
+	if e == nil || len(date) < 7 {
+		return
+	}
+	go func() {
+		var categoryID string
+		if err := e.DB.QueryRow(`SELECT category_id FROM items WHERE id = ?`, itemID).Scan(&categoryID); err != nil {
+			log.Println("alerts:", err)
+			return
+		}
+		if err := e.Check(context.Background(), date[:7], categoryID); err != nil {
+			log.Println("alerts:", err)
+		}
+	}()
+}
+
+// ForMonth re-checks, in the background, month (YYYY-MM) overall and for
+// every category with a budget in it.
+func (e *Evaluator) ForMonth(month string) {
+	if e == nil {
+		return
+	}
+	go func() {
+		rows, err := e.DB.Query(`SELECT category_id FROM category_budgets WHERE month = ?`, month+"-01")
+		if err != nil {
+			log.Println("alerts:", err)
+			return
+		}
+		var cats []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err == nil {
+				cats = append(cats, id)
+			}
+		}
+		rows.Close()
+
+		if err := e.Check(context.Background(), month, cats...); err != nil {
+			log.Println("alerts:", err)
+		}
+	}()
+}
+
+// Check compares spending in month (YYYY-MM) against the overall budget and
+// the budgets of categoryIDs, recording and sending any new alerts. When a
+// single change crosses several thresholds all are recorded but only the
+// highest is sent.
+func (e *Evaluator) Check(ctx context.Context, month string, categoryIDs ...string) error {
+	thresholds, err := e.thresholds()
+	if err != nil || len(thresholds) == 0 {
+		return err
+	}
+
+	if err := e.checkScope(ctx, month, "", thresholds); err != nil {
+		return err
+	}
+	slices.Sort(categoryIDs)
+	for _, id := range slices.Compact(categoryIDs) {
+		if id == "" {
+			continue
+		}
+		if err := e.checkScope(ctx, month, id, thresholds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Evaluator) thresholds() ([]int, error) {
+	rows, err := e.DB.Query(`SELECT percent FROM alert_thresholds ORDER BY percent`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []int
+	for rows.Next() {
+		var p int
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// checkScope checks one budget: the overall one when categoryID is empty.
+func (e *Evaluator) checkScope(ctx context.Context, month, categoryID string, thresholds []int) error {
+	monthDate := month + "-01"
+
+	var budget money.Fils
+	var spent money.Fils
+	var name string
+	var err error
+	if categoryID == "" {
+		name = "Overall"
+		err = e.DB.QueryRow(`SELECT max_budget_fils FROM monthly_budgets WHERE month = ?`, monthDate).Scan(&budget)
+		if err == nil {
+			err = e.DB.QueryRow(`
+				SELECT COALESCE(SUM(total_price_fils), 0) FROM expenses WHERE substr(purchase_date, 1, 7) = ?
+			`, month).Scan(&spent)
+		}
+	} else {
+		err = e.DB.QueryRow(`
+			SELECT cb.max_budget_fils, c.name
+			FROM category_budgets cb
+			JOIN categories c ON c.id = cb.category_id
+			WHERE cb.month = ? AND cb.category_id = ?
+		`, monthDate, categoryID).Scan(&budget, &name)
+		if err == nil {
+			err = e.DB.QueryRow(`
+				SELECT COALESCE(SUM(e.total_price_fils), 0)
+				FROM expenses e
+				JOIN items i ON i.id = e.item_id
+				WHERE substr(e.purchase_date, 1, 7) = ? AND i.category_id = ?
+			`, month, categoryID).Scan(&spent)
+		}
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == sql.ErrNoRows || budget <= 0 {
+		return nil // no budget, nothing to alert on
+	}
+
+	highest := 0
+	for _, p := range thresholds {
+		if int64(spent)*100 < int64(budget)*int64(p) {
+			break
+		}
+		res, err := e.DB.Exec(`
+			INSERT OR IGNORE INTO budget_alerts (id, month, category_id, percent, spent_fils, budget_fils)
+			VALUES (?, ?, NULLIF(?, ''), ?, ?, ?)
+		`, uuid.NewString(), monthDate, categoryID, p, spent, budget)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			highest = p
+		}
+	}
+	if highest == 0 {
+		return nil
+	}
+
+	return e.send(ctx, notify.Message{
+		Subject: fmt.Sprintf("Budget alert: %s spending at %d%% for %s", name, highest, month),
+		Body: fmt.Sprintf("%s spending for %s has reached %d%% of its budget: %s of %s BD.\n\n%s/dashboard?month=%s\n",
+			name, month, highest, spent, budget, e.AppURL, month),
+	})
+}
+
+func (e *Evaluator) send(ctx context.Context, m notify.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	if e.Webhook != nil {
+		if err := e.Webhook.Notify(ctx, m); err != nil {
+			log.Println("alerts: webhook:", err)
+		}
+	}
+	if e.Email == nil {
+		return nil
+	}
+
+	emails, err := e.recipients()
+	if err != nil {
+		return err
+	}
+	for _, to := range emails {
+		m.To = to
+		if err := e.Email.Notify(ctx, m); err != nil {
+			log.Println("alerts: email to", to+":", err)
+		}
+	}
+	return nil
+}
+
+// recipients returns the emails of active users whose role may set budgets.
+func (e *Evaluator) recipients() ([]string, error) {
+	rows, err := e.DB.Query(`SELECT email, role FROM users WHERE disabled_at IS NULL ORDER BY email`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var email, role string
+		if err := rows.Scan(&email, &role); err != nil {
+			return nil, err
+		}
+		if auth.RoleHas(role, auth.PermBudgetsWrite) {
+			out = append(out, email)
+		}
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,187 @@
+// Package audit appends to the audit log: who changed which row, from where,
+// and what it looked like before and after. Entries are never updated or
+// deleted; migration 021 enforces that with triggers.
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/httpx"
+)
+
+const (
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+)
+
+// DB is satisfied by *sql.DB and *sql.Tx.
+type DB interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Actor is who made a change. The zero Actor is the server itself.
+type Actor struct {
+	UserID string
+	IP     string
+}
+
+// ActorFrom returns the signed-in user and client address of r.
+func ActorFrom(r *http.Request) Actor {
+	return Actor{UserID: auth.UserIDFromContext(r), IP: httpx.ClientIP(r)}
+}
+
+// Entry is one change. Before and After are marshalled to JSON; nil is
+// stored as NULL.
+type Entry struct {
+	Actor    Actor
+	Action   string
+	Entity   string // table name
+	EntityID string
+	Before   any
+	After    any
+}
+
+// Write appends e to the log.
+func Write(db DB, e Entry) error {
+	before, err := marshal(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshal(e.After)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO audit_log (at, actor_id, ip, action, entity, entity_id, before_json, after_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, time.Now().UTC(), nullable(e.Actor.UserID), nullable(e.Actor.IP), e.Action, e.Entity, e.EntityID, before, after)
+	return err
+}
+
+func marshal(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if m, ok := v.(map[string]any); ok && m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func nullable(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// redacted columns never reach the log.
+var redacted = map[string]bool{
+	"password_hash": true,
+}
+
+// Row reads the row of table matching where as a column → value map, or nil
+// when there is none. table and where must not come from user input.
+func Row(db DB, table, where string, args ...any) (map[string]any, error) {
+	rows, err := db.Query(`SELECT * FROM `+table+` WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]any, len(cols))
+	dest := make([]any, len(cols))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]any, len(cols))
+	for i, c := range cols {
+		if redacted[c] {
+			continue
+		}
+		if b, ok := vals[i].([]byte); ok {
+			vals[i] = string(b)
+		}
+		out[c] = vals[i]
+	}
+	return out, nil
+}
+
+// Change follows one row through a modification: Track reads it before,
+// Record reads it again after and logs both.
+type Change struct {
+	table, where string
+	args         []any
+	before       map[string]any
+	err          error
+}
+
+// Track reads the current state of the row of table matching where. Pass it
+// before changing the row; for a row about to be inserted it reads nothing.
+func Track(db DB, table, where string, args ...any) *Change {
+	c := &Change{table: table, where: where, args: args}
+	c.before, c.err = Row(db, table, where, args...)
+	return c
+}
+
+// Record reads the row as it is now and logs the change. Nothing is logged
+// when the row neither existed before nor exists now. An empty action is
+// taken to be Create, Update or Delete according to which of the two exist,
+// which suits upserts.
+func (c *Change) Record(db DB, a Actor, action string) error {
+	if c.err != nil {
+		return fmt.Errorf("%s: %w", c.table, c.err)
+	}
+	after, err := Row(db, c.table, c.where, c.args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.table, err)
+	}
+	switch {
+	case c.before == nil && after == nil:
+		return nil
+	case action != "":
+	case c.before == nil:
+		action = Create
+	case after == nil:
+		action = Delete
+	default:
+		action = Update
+	}
+
+	id := ""
+	for _, row := range []map[string]any{after, c.before} {
+		if v, ok := row["id"]; ok && v != nil {
+			id = fmt.Sprint(v)
+			break
+		}
+	}
+	return Write(db, Entry{Actor: a, Action: action, Entity: c.table, EntityID: id, Before: c.before, After: after})
+}
+
+// Inserted is the Change of a row that did not exist before, for rows whose
+// key is only known once they are inserted.
+func Inserted(table, where string, args ...any) *Change {
+	return &Change{table: table, where: where, args: args}
+}
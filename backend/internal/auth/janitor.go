@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// RunJanitor purges expired sessions and other short-lived auth rows every
+// interval. It blocks; start it with go.
+func RunJanitor(conn *sql.DB, every time.Duration) {
+	for {
+		if err := purgeExpired(conn, time.Now().UTC()); err != nil {
+			log.Println("janitor:", err)
+		}
+		time.Sleep(every)
+	}
+}
+
+func purgeExpired(conn *sql.DB, now time.Time) error {
+	stmts := []struct {
+		query string
+		arg   time.Time
+	}{
+		{`DELETE FROM sessions WHERE expires_at < ?`, now},
+		{`DELETE FROM login_challenges WHERE expires_at < ?`, now},
+		{`DELETE FROM password_resets WHERE expires_at < ?`, now.Add(-24 * time.Hour)},
+		{`DELETE FROM login_attempts WHERE attempted_at < ?`, now.Add(-24 * time.Hour)},
+	}
+	for _, s := range stmts {
+		if _, err := conn.Exec(s.query, s.arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"almanarteen-backend/internal/totp"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMFAEnabled       = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled   = errors.New("start two-factor enrollment first")
+	ErrInvalidCode      = errors.New("invalid code")
+	ErrInvalidChallenge = errors.New("login challenge is invalid or has expired, sign in again")
+)
+
+const (
+	challengeTTL         = 5 * time.Minute
+	challengeMaxAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+// MFA manages TOTP enrollment, recovery codes and the second login step.
+// Now is the clock; swap it for a fixed one to check codes offline.
+type MFA struct {
+	DB     *sql.DB
+	Issuer string
+	Now    func() time.Time
+}
+
+func NewMFA(conn *sql.DB, issuer string) MFA {
+	return MFA{DB: conn, Issuer: issuer, Now: time.Now}
+}
+
+// Enabled reports whether the user has a confirmed second factor.
+func (m MFA) Enabled(userID string) (bool, error) {
+	var n int
+	err := m.DB.QueryRow(`SELECT COUNT(1) FROM user_totp WHERE user_id = ? AND confirmed_at IS NOT NULL`, userID).Scan(&n)
+	return n > 0, err
+}
+
+// Enroll starts (or restarts) enrollment with a fresh secret. It does not
+// take effect until Confirm succeeds.
+func (m MFA) Enroll(userID, account string) (secret, uri string, err error) {
+	on, err := m.Enabled(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if on {
+		return "", "", ErrMFAEnabled
+	}
+
+	secret = totp.GenerateSecret()
+	_, err = m.DB.Exec(`
+		INSERT INTO user_totp (user_id, secret) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+	`, userID, secret)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(m.Issuer, account, secret), nil
+}
+
+// Confirm turns the second factor on once the user proves their app
+// produces valid codes, and returns a fresh set of one-time recovery codes.
+func (m MFA) Confirm(userID, code string) ([]string, error) {
+	var secret string
+	var confirmed bool
+	err := m.DB.QueryRow(`SELECT secret, confirmed_at IS NOT NULL FROM user_totp WHERE user_id = ?`, userID).Scan(&secret, &confirmed)
+	if err == sql.ErrNoRows {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if confirmed {
+		return nil, ErrMFAEnabled
+	}
+
+	step, ok := totp.Validate(secret, code, m.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE user_totp SET confirmed_at = ?, last_step = ? WHERE user_id = ?`, m.Now().UTC(), step, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i] = newRecoveryCode()
+		if _, err := tx.Exec(`
+			INSERT INTO recovery_codes (id, user_id, code_hash) VALUES (?, ?, ?)
+		`, uuid.NewString(), userID, HashToken(normalizeRecoveryCode(codes[i]))); err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, tx.Commit()
+}
+
+// Disable removes the second factor and its recovery codes.
+func (m MFA) Disable(userID string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// NewChallenge records that userID passed the password step and returns
+// the token the client presents with the second factor.
+func (m MFA) NewChallenge(userID string) (string, error) {
+	token := NewToken()
+	_, err := m.DB.Exec(`
+		INSERT INTO login_challenges (id, user_id, expires_at) VALUES (?, ?, ?)
+	`, HashToken(token), userID, m.Now().Add(challengeTTL).UTC())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ChallengeUser returns the user a live login challenge belongs to, so the
+// login throttle can be checked before any code is tried.
+func (m MFA) ChallengeUser(token string) (string, error) {
+	var userID string
+	var expires time.Time
+	err := m.DB.QueryRow(`SELECT user_id, expires_at FROM login_challenges WHERE id = ?`, HashToken(token)).Scan(&userID, &expires)
+	if err == sql.ErrNoRows || (err == nil && m.Now().After(expires)) {
+		return "", ErrInvalidChallenge
+	}
+	return userID, err
+}
+
+// CompleteChallenge checks a TOTP code or, failing that, a recovery code
+// against a login challenge and returns the user it belongs to. A challenge
+// is single-use and dies after a few wrong codes. With ErrInvalidCode the
+// user is returned too, so the failure can be counted against them.
+func (m MFA) CompleteChallenge(token, code, recoveryCode string) (string, error) {
+	id := HashToken(token)
+
+	var userID, secret string
+	var attempts int
+	var lastStep int64
+	var expires time.Time
+	err := m.DB.QueryRow(`
+		SELECT c.user_id, c.attempts, c.expires_at, t.secret, t.last_step
+		FROM login_challenges c
+		JOIN user_totp t ON t.user_id = c.user_id AND t.confirmed_at IS NOT NULL
+		WHERE c.id = ?
+	`, id).Scan(&userID, &attempts, &expires, &secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidChallenge
+	}
+	if err != nil {
+		return "", err
+	}
+	if attempts >= challengeMaxAttempts || m.Now().After(expires) {
+		_, _ = m.DB.Exec(`DELETE FROM login_challenges WHERE id = ?`, id)
+		return "", ErrInvalidChallenge
+	}
+
+	ok := false
+	if code != "" {
+		if step, valid := totp.Validate(secret, code, m.Now()); valid && step > lastStep {
+			res, err := m.DB.Exec(`UPDATE user_totp SET last_step = ? WHERE user_id = ? AND last_step < ?`, step, userID, step)
+			if err != nil {
+				return "", err
+			}
+			n, _ := res.RowsAffected()
+			ok = n > 0
+		}
+	} else if recoveryCode != "" {
+		res, err := m.DB.Exec(`
+			UPDATE recovery_codes SET used_at = ?
+			WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+		`, m.Now().UTC(), userID, HashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return "", err
+		}
+		n, _ := res.RowsAffected()
+		ok = n > 0
+	}
+
+	if !ok {
+		_, _ = m.DB.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE id = ?`, id)
+		return userID, ErrInvalidCode
+	}
+
+	_, _ = m.DB.Exec(`DELETE FROM login_challenges WHERE id = ?`, id)
+	return userID, nil
+}
+
+// RemainingRecoveryCodes counts the unused recovery codes of a user.
+func (m MFA) RemainingRecoveryCodes(userID string) (int, error) {
+	var n int
+	err := m.DB.QueryRow(`SELECT COUNT(1) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+// newRecoveryCode returns a code like "k3m9q-x7h2p".
+func newRecoveryCode() string {
+	b := make([]byte, 7)
+	_, _ = rand.Read(b)
+	s := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return s[:5] + "-" + s[5:]
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"almanarteen-backend/internal/db"
+	"almanarteen-backend/internal/totp"
+)
+
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.ApplyMigrations(conn, "../../migrations"); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// enrolled returns an MFA on a fixed clock and a user with a confirmed
+// second factor, along with their secret and recovery codes.
+func enrolled(t *testing.T) (*MFA, *time.Time, string, string, []string) {
+	t.Helper()
+	conn := testDB(t)
+	userID, err := CreateUser(conn, "Test", "test@example.com", "password123", RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMFA(conn, "Test")
+	m.Now = func() time.Time { return now }
+
+	secret, _, err := m.Enroll(userID, "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := totp.Code(secret, now)
+	codes, err := m.Confirm(userID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &m, &now, userID, secret, codes
+}
+
+func challenge(t *testing.T, m *MFA, userID string) string {
+	t.Helper()
+	c, err := m.NewChallenge(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCompleteChallengeRejectsReplayedCode(t *testing.T) {
+	m, now, userID, secret, _ := enrolled(t)
+
+	// The code used to confirm enrollment cannot log in.
+	code, _ := totp.Code(secret, *now)
+	if _, err := m.CompleteChallenge(challenge(t, m, userID), code, ""); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("confirmation code reused: err = %v; want ErrInvalidCode", err)
+	}
+
+	*now = now.Add(totp.Period * time.Second)
+	code, _ = totp.Code(secret, *now)
+	got, err := m.CompleteChallenge(challenge(t, m, userID), code, "")
+	if err != nil || got != userID {
+		t.Fatalf("fresh code: CompleteChallenge = %q, %v", got, err)
+	}
+
+	if _, err := m.CompleteChallenge(challenge(t, m, userID), code, ""); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("code replayed: err = %v; want ErrInvalidCode", err)
+	}
+
+	// An earlier step still within the skew is refused as well.
+	old, _ := totp.CodeAt(secret, totp.Step(*now)-1)
+	if _, err := m.CompleteChallenge(challenge(t, m, userID), old, ""); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("older code: err = %v; want ErrInvalidCode", err)
+	}
+}
+
+func TestCompleteChallengeRecoveryCodeIsSingleUse(t *testing.T) {
+	m, _, userID, _, codes := enrolled(t)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes; want %d", len(codes), recoveryCodeCount)
+	}
+
+	// Case, spaces and the dash do not matter.
+	typed := " " + codes[0][:5] + codes[0][6:] + " "
+	got, err := m.CompleteChallenge(challenge(t, m, userID), "", typed)
+	if err != nil || got != userID {
+		t.Fatalf("recovery code: CompleteChallenge = %q, %v", got, err)
+	}
+	if _, err := m.CompleteChallenge(challenge(t, m, userID), "", codes[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("recovery code reused: err = %v; want ErrInvalidCode", err)
+	}
+	if n, err := m.RemainingRecoveryCodes(userID); err != nil || n != recoveryCodeCount-1 {
+		t.Errorf("RemainingRecoveryCodes = %d, %v; want %d", n, err, recoveryCodeCount-1)
+	}
+}
+
+func TestCompleteChallengeLimits(t *testing.T) {
+	m, now, userID, secret, _ := enrolled(t)
+
+	c := challenge(t, m, userID)
+	for i := 0; i < challengeMaxAttempts; i++ {
+		got, err := m.CompleteChallenge(c, "000000", "")
+		if !errors.Is(err, ErrInvalidCode) || got != userID {
+			t.Fatalf("attempt %d: CompleteChallenge = %q, %v; want user and ErrInvalidCode", i+1, got, err)
+		}
+	}
+	*now = now.Add(totp.Period * time.Second)
+	code, _ := totp.Code(secret, *now)
+	if _, err := m.CompleteChallenge(c, code, ""); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("after %d wrong codes: err = %v; want ErrInvalidChallenge", challengeMaxAttempts, err)
+	}
+
+	c = challenge(t, m, userID)
+	*now = now.Add(challengeTTL + time.Second)
+	code, _ = totp.Code(secret, *now)
+	if _, err := m.ChallengeUser(c); !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("expired challenge: ChallengeUser err = %v; want ErrInvalidChallenge", err)
+	}
+	if _, err := m.CompleteChallenge(c, code, ""); !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("expired challenge: err = %v; want ErrInvalidChallenge", err)
+	}
+}
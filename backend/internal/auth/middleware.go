@@ -2,41 +2,150 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 )
 
 type ctxKey string
 
-const CtxUserID ctxKey = "userID"
+const (
+	CtxUserID    ctxKey = "userID"
+	CtxRole      ctxKey = "role"
+	CtxSessionID ctxKey = "sessionID" // hashed id, as stored in sessions.id
+	CtxCSRFToken ctxKey = "csrfToken"
+	CtxScopes    ctxKey = "scopes" // set only for API token requests
+)
+
+// Guard authenticates requests by session cookie or API token and checks
+// permissions.
+type Guard struct {
+	DB       *sql.DB
+	Sessions SessionPolicy
+}
+
+// seenEvery limits how often last_seen_at/last_used_at is written for a busy
+// session or token.
+const seenEvery = time.Minute
 
-func RequireAdmin(conn *sql.DB, next http.Handler) http.Handler {
+// Authenticated lets through any signed-in user, or a request bearing a
+// valid API token. Cookie requests that can change state must also carry the
+// session's CSRF token in X-CSRF-Token; bearer requests are not sent
+// automatically by browsers and need no CSRF token.
+func (g Guard) Authenticated(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			g.tokenAuth(w, r, strings.TrimSpace(token), next)
+			return
+		}
+
 		c, err := r.Cookie(CookieName)
 		if err != nil || c.Value == "" {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
+		sid := HashToken(c.Value)
 
-		var userID, role string
+		var userID, role, csrf string
 		var expires time.Time
-		err = conn.QueryRow(`
-			SELECT u.id, u.role, s.expires_at
+		var lastSeen sql.NullTime
+		err = g.DB.QueryRow(`
+			SELECT u.id, u.role, s.expires_at, s.last_seen_at, s.csrf_token
 			FROM sessions s
 			JOIN users u ON u.id = s.user_id
-			WHERE s.id = ?
-		`, c.Value).Scan(&userID, &role, &expires)
-		if err != nil || role != "admin" || time.Now().After(expires) {
+			WHERE s.id = ? AND u.disabled_at IS NULL
+		`, sid).Scan(&userID, &role, &expires, &lastSeen, &csrf)
+		now := time.Now()
+		if err != nil || now.After(expires) {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
 
+		if !safeMethod(r.Method) && subtle.ConstantTimeCompare([]byte(r.Header.Get(CSRFHeader)), []byte(csrf)) != 1 {
+			http.Error(w, "invalid csrf token", http.StatusForbidden)
+			return
+		}
+
+		if g.Sessions.Sliding && expires.Sub(now) < g.Sessions.TTL/2 {
+			exp := now.Add(g.Sessions.TTL)
+			if _, err := g.DB.Exec(`UPDATE sessions SET expires_at = ?, last_seen_at = ? WHERE id = ?`, exp.UTC(), now.UTC(), sid); err == nil {
+				SetSessionCookie(w, c.Value, exp)
+			}
+		} else if !lastSeen.Valid || now.Sub(lastSeen.Time) > seenEvery {
+			_, _ = g.DB.Exec(`UPDATE sessions SET last_seen_at = ? WHERE id = ?`, now.UTC(), sid)
+		}
+
 		ctx := context.WithValue(r.Context(), CtxUserID, userID)
+		ctx = context.WithValue(ctx, CtxRole, role)
+		ctx = context.WithValue(ctx, CtxSessionID, sid)
+		ctx = context.WithValue(ctx, CtxCSRFToken, csrf)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func (g Guard) tokenAuth(w http.ResponseWriter, r *http.Request, token string, next http.Handler) {
+	var id, userID, role, scopes string
+	var expires time.Time
+	var lastUsed sql.NullTime
+	err := g.DB.QueryRow(`
+		SELECT t.id, u.id, u.role, t.scopes, t.expires_at, t.last_used_at
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND t.revoked_at IS NULL AND u.disabled_at IS NULL
+	`, HashToken(token)).Scan(&id, &userID, &role, &scopes, &expires, &lastUsed)
+	now := time.Now()
+	if err != nil || now.After(expires) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !lastUsed.Valid || now.Sub(lastUsed.Time) > seenEvery {
+		_, _ = g.DB.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now.UTC(), id)
+	}
+
+	ctx := context.WithValue(r.Context(), CtxUserID, userID)
+	ctx = context.WithValue(ctx, CtxRole, role)
+	ctx = context.WithValue(ctx, CtxScopes, SplitScopes(scopes))
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// SessionOnly is Authenticated without API tokens, for account settings a
+// script has no business touching (passwords, 2FA, sessions, tokens).
+func (g Guard) SessionOnly(next http.Handler) http.Handler {
+	return g.Authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ViaAPIToken(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+func safeMethod(m string) bool {
+	return m == http.MethodGet || m == http.MethodHead || m == http.MethodOptions
+}
+
+// Require lets through signed-in users whose role grants p. API tokens
+// also need p among their scopes.
+func (g Guard) Require(p Permission, next http.Handler) http.Handler {
+	return g.Authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Can(r, p) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// Can reports whether the authenticated request may use p, for handlers
+// whose optional features need more than the route's permission.
+func Can(r *http.Request, p Permission) bool {
+	return RoleHas(RoleFromContext(r), p) && (!ViaAPIToken(r) || slices.Contains(ScopesFromContext(r), p))
+}
+
 func UserIDFromContext(r *http.Request) string {
 	if v := r.Context().Value(CtxUserID); v != nil {
 		if s, ok := v.(string); ok {
@@ -45,3 +154,44 @@ func UserIDFromContext(r *http.Request) string {
 	}
 	return ""
 }
+
+func RoleFromContext(r *http.Request) string {
+	if v := r.Context().Value(CtxRole); v != nil {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+func SessionIDFromContext(r *http.Request) string {
+	if v := r.Context().Value(CtxSessionID); v != nil {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+func CSRFTokenFromContext(r *http.Request) string {
+	if v := r.Context().Value(CtxCSRFToken); v != nil {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// ScopesFromContext returns the scopes of the API token behind r, or nil
+// for cookie sessions.
+func ScopesFromContext(r *http.Request) []Permission {
+	if v, ok := r.Context().Value(CtxScopes).([]Permission); ok {
+		return v
+	}
+	return nil
+}
+
+// ViaAPIToken reports whether r was authenticated with an API token.
+func ViaAPIToken(r *http.Request) bool {
+	return r.Context().Value(CtxScopes) != nil
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidResetToken = errors.New("reset link is invalid or has expired")
+
+// CreatePasswordReset issues a single-use reset token for a user, replacing
+// any earlier unused one. Only the token's hash is stored.
+func CreatePasswordReset(conn *sql.DB, userID string, ttl time.Duration) (string, error) {
+	token := NewToken()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM password_resets WHERE user_id = ? AND used_at IS NULL`, userID); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO password_resets (id, user_id, token_hash, expires_at)
+		VALUES (?, ?, ?, ?)
+	`, uuid.NewString(), userID, HashToken(token), time.Now().Add(ttl).UTC()); err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit()
+}
+
+// PasswordResetUser returns the user a reset token was issued to, or
+// ErrInvalidResetToken when it is unknown, used or expired.
+func PasswordResetUser(tx *sql.Tx, token string) (string, error) {
+	_, userID, err := passwordReset(tx, token)
+	return userID, err
+}
+
+// ConsumePasswordReset sets a new password using a reset token, marks the
+// token used and revokes every session of the user, all in tx; the caller
+// commits it, so the change can be audited alongside.
+func ConsumePasswordReset(tx *sql.Tx, token, password string) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	id, userID, err := passwordReset(tx, token)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE password_resets SET used_at = ? WHERE id = ?`, time.Now().UTC(), id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, hash, userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+	return err
+}
+
+func passwordReset(tx *sql.Tx, token string) (id, userID string, err error) {
+	var expires time.Time
+	err = tx.QueryRow(`
+		SELECT id, user_id, expires_at
+		FROM password_resets
+		WHERE token_hash = ? AND used_at IS NULL
+	`, HashToken(token)).Scan(&id, &userID, &expires)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expires)) {
+		return "", "", ErrInvalidResetToken
+	}
+	return id, userID, err
+}
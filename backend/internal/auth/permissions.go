@@ -0,0 +1,63 @@
+package auth
+
+// Permission names a capability checked per route. The same strings are
+// used as scopes wherever a narrower grant than a full role is needed.
+type Permission string
+
+const (
+	PermExpensesRead  Permission = "expenses:read"
+	PermExpensesWrite Permission = "expenses:write"
+	PermBudgetsWrite  Permission = "budgets:write"
+	PermCatalogRead   Permission = "catalog:read"
+	PermCatalogWrite  Permission = "catalog:write"
+	PermReportsRead   Permission = "reports:read"
+	PermUsersManage   Permission = "users:manage"
+	PermPeriodsClose  Permission = "periods:close"
+	PermPeriodsReopen Permission = "periods:reopen"
+	PermAuditRead     Permission = "audit:read"
+)
+
+const (
+	RoleAdmin     = "admin"
+	RoleManager   = "manager"
+	RolePurchaser = "purchaser"
+	RoleViewer    = "viewer"
+)
+
+// Roles maps every role (as stored in users.role) to what it may do.
+var Roles = map[string][]Permission{
+	RoleAdmin: {
+		PermExpensesRead, PermExpensesWrite, PermBudgetsWrite,
+		PermCatalogRead, PermCatalogWrite, PermReportsRead, PermUsersManage,
+		PermPeriodsClose, PermPeriodsReopen, PermAuditRead,
+	},
+	RoleManager: {
+		PermExpensesRead, PermExpensesWrite, PermBudgetsWrite,
+		PermCatalogRead, PermCatalogWrite, PermReportsRead,
+		PermPeriodsClose,
+	},
+	// kitchen staff: log purchases, nothing else
+	RolePurchaser: {
+		PermExpensesRead, PermExpensesWrite, PermCatalogRead,
+	},
+	// accountant: read-only
+	RoleViewer: {
+		PermExpensesRead, PermCatalogRead, PermReportsRead,
+	},
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := Roles[role]
+	return ok
+}
+
+// RoleHas reports whether role grants p.
+func RoleHas(role string, p Permission) bool {
+	for _, q := range Roles[role] {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
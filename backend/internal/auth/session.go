@@ -3,22 +3,66 @@ package auth
 import (
 	"database/sql"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
-	"github.com/google/uuid"
+	"almanarteen-backend/internal/httpx"
 )
 
 const CookieName = "almanarteen_session"
 
-func CreateSession(conn *sql.DB, userID string, days int) (string, time.Time, error) {
-	sid := uuid.NewString()
-	exp := time.Now().Add(time.Hour * 24 * time.Duration(days))
+// CSRFHeader carries the session's CSRF token on state-changing requests.
+const CSRFHeader = "X-CSRF-Token"
 
-	_, err := conn.Exec(`INSERT INTO sessions (id, user_id, expires_at) VALUES (?, ?, ?)`, sid, userID, exp.UTC())
+// SessionPolicy says how long sessions last. With Sliding, a session in
+// use is pushed out to a full TTL again once less than half of it is left.
+type SessionPolicy struct {
+	TTL     time.Duration
+	Sliding bool
+}
+
+// SessionPolicyFromEnv reads SESSION_TTL_HOURS (default 14 days) and
+// SESSION_SLIDING ("1" or "true" to enable renewal).
+func SessionPolicyFromEnv() SessionPolicy {
+	p := SessionPolicy{TTL: 14 * 24 * time.Hour}
+	if h, err := strconv.Atoi(os.Getenv("SESSION_TTL_HOURS")); err == nil && h > 0 {
+		p.TTL = time.Duration(h) * time.Hour
+	}
+	switch os.Getenv("SESSION_SLIDING") {
+	case "1", "true":
+		p.Sliding = true
+	}
+	return p
+}
+
+// IssuedSession is what the client receives when a session starts. Only
+// the hash of Token is stored, so a copy of the database holds no usable
+// session. CSRFToken has to accompany every cookie-authenticated write.
+type IssuedSession struct {
+	Token     string
+	CSRFToken string
+	Expires   time.Time
+}
+
+// CreateSession starts a session for userID, remembering the device it was
+// created from so the user can recognize it in their session list.
+func CreateSession(conn *sql.DB, r *http.Request, userID string, ttl time.Duration) (IssuedSession, error) {
+	now := time.Now()
+	s := IssuedSession{
+		Token:     NewToken(),
+		CSRFToken: NewToken(),
+		Expires:   now.Add(ttl),
+	}
+
+	_, err := conn.Exec(`
+		INSERT INTO sessions (id, user_id, expires_at, user_agent, ip, last_seen_at, csrf_token)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, HashToken(s.Token), userID, s.Expires.UTC(), r.UserAgent(), httpx.ClientIP(r), now.UTC(), s.CSRFToken)
 	if err != nil {
-		return "", time.Time{}, err
+		return IssuedSession{}, err
 	}
-	return sid, exp, nil
+	return s, nil
 }
 
 func SetSessionCookie(w http.ResponseWriter, sid string, exp time.Time) {
@@ -44,3 +88,9 @@ func ClearSessionCookie(w http.ResponseWriter) {
 		Secure:   false,
 	})
 }
+
+// RevokeUserSessions signs a user out of every device.
+func RevokeUserSessions(conn Execer, userID string) error {
+	_, err := conn.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+	return err
+}
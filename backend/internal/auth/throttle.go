@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Throttle slows down password guessing. Each failed attempt for an email
+// doubles the wait before the next one, and MaxFailures in a row lock the
+// email out for Lockout. Failures from one IP across all emails are limited
+// the same way with IPMaxFailures. Attempts live in login_attempts, so
+// restarts do not reset the counters.
+type Throttle struct {
+	DB            *sql.DB
+	MaxFailures   int           // consecutive failures per email before lockout
+	IPMaxFailures int           // failures per IP within Window before lockout
+	BaseDelay     time.Duration // wait after the first failure
+	Lockout       time.Duration
+	Window        time.Duration // failures older than this are forgotten
+	Now           func() time.Time
+}
+
+func NewThrottle(conn *sql.DB) Throttle {
+	return Throttle{
+		DB:            conn,
+		MaxFailures:   5,
+		IPMaxFailures: 20,
+		BaseDelay:     time.Second,
+		Lockout:       15 * time.Minute,
+		Window:        time.Hour,
+		Now:           time.Now,
+	}
+}
+
+// Check returns how long a login for email from ip has to wait; zero means
+// the attempt may proceed.
+func (t Throttle) Check(email, ip string) (time.Duration, error) {
+	now := t.Now()
+	since := now.Add(-t.Window).UTC()
+
+	// consecutive failures for the email: those after its last success
+	n, last, err := t.failures(`
+		SELECT COUNT(1), MAX(attempted_at)
+		FROM login_attempts
+		WHERE email = ? AND succeeded = 0 AND attempted_at > ?
+		  AND attempted_at > COALESCE((SELECT MAX(attempted_at) FROM login_attempts WHERE email = ? AND succeeded = 1), '')
+	`, email, since, email)
+	if err != nil {
+		return 0, err
+	}
+	wait := t.wait(n, t.MaxFailures, last, now)
+
+	n, last, err = t.failures(`
+		SELECT COUNT(1), MAX(attempted_at)
+		FROM login_attempts
+		WHERE ip = ? AND succeeded = 0 AND attempted_at > ?
+	`, ip, since)
+	if err != nil {
+		return 0, err
+	}
+	// The first half of the IP allowance is free, so a few typos on the
+	// restaurant's shared connection don't slow everyone down.
+	free := t.IPMaxFailures / 2
+	if w := t.wait(n-free, t.IPMaxFailures-free, last, now); w > wait {
+		wait = w
+	}
+
+	return wait, nil
+}
+
+func (t Throttle) failures(query string, args ...any) (int, time.Time, error) {
+	var n int
+	var last sql.NullString
+	if err := t.DB.QueryRow(query, args...).Scan(&n, &last); err != nil {
+		return 0, time.Time{}, err
+	}
+	if !last.Valid {
+		return 0, time.Time{}, nil
+	}
+	ts, err := parseTime(last.String)
+	return n, ts, err
+}
+
+// wait is the exponential backoff: BaseDelay doubled for each failure after
+// the first, capped at Lockout, and the full Lockout once max is reached.
+func (t Throttle) wait(n, max int, last, now time.Time) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	d := t.Lockout
+	if n < max {
+		d = t.BaseDelay << (n - 1)
+		if d <= 0 || d > t.Lockout {
+			d = t.Lockout
+		}
+	}
+	if w := last.Add(d).Sub(now); w > 0 {
+		return w
+	}
+	return 0
+}
+
+// Record stores the outcome of an attempt. RunJanitor drops old ones.
+func (t Throttle) Record(email, ip string, ok bool) error {
+	_, err := t.DB.Exec(`
+		INSERT INTO login_attempts (email, ip, succeeded, attempted_at)
+		VALUES (?, ?, ?, ?)
+	`, email, ip, ok, t.Now().UTC())
+	return err
+}
+
+// UnlockLogin clears the failed attempts of an email so it can sign in
+// again right away.
+func UnlockLogin(conn Execer, email string) error {
+	_, err := conn.Exec(`DELETE FROM login_attempts WHERE email = ? AND succeeded = 0`, NormalizeEmail(email))
+	return err
+}
+
+// parseTime reads a timestamp in the format go-sqlite3 writes for time.Time
+// (MAX() drops the column type, so the driver hands back the raw text).
+func parseTime(s string) (time.Time, error) {
+	return time.Parse("2006-01-02 15:04:05.999999999-07:00", s)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"almanarteen-backend/internal/db"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrEmailTaken   = errors.New("a user with this email already exists")
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrWeakPassword = errors.New("password must be at least 8 characters")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// Execer is satisfied by *sql.DB and *sql.Tx, so user changes can be made
+// in the caller's transaction.
+type Execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// NormalizeEmail is applied to every email before it is stored or looked up.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func ValidatePassword(password string) error {
+	if len(password) < 8 {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// RandomPassword returns a temporary password for invited users.
+func RandomPassword() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// CreateUser validates and inserts a user, returning its id.
+func CreateUser(conn Execer, name, email, password, role string) (string, error) {
+	if !ValidRole(role) {
+		return "", ErrInvalidRole
+	}
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	id := uuid.NewString()
+	_, err = conn.Exec(`
+		INSERT INTO users (id, name, email, password_hash, role)
+		VALUES (?, ?, ?, ?, ?)
+	`, id, strings.TrimSpace(name), NormalizeEmail(email), hash, role)
+	if db.IsUniqueViolation(err) {
+		return "", ErrEmailTaken
+	}
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SetPassword replaces a user's password and signs them out everywhere.
+func SetPassword(conn Execer, userID, password string) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := updateUser(conn, `UPDATE users SET password_hash = ? WHERE id = ?`, hash, userID); err != nil {
+		return err
+	}
+	return RevokeUserSessions(conn, userID)
+}
+
+func SetRole(conn Execer, userID, role string) error {
+	if !ValidRole(role) {
+		return ErrInvalidRole
+	}
+	return updateUser(conn, `UPDATE users SET role = ? WHERE id = ?`, role, userID)
+}
+
+// SetDisabled deactivates or re-enables a user. Deactivation revokes all of
+// the user's sessions immediately.
+func SetDisabled(conn Execer, userID string, disabled bool) error {
+	if !disabled {
+		return updateUser(conn, `UPDATE users SET disabled_at = NULL WHERE id = ?`, userID)
+	}
+	if err := updateUser(conn, `UPDATE users SET disabled_at = COALESCE(disabled_at, CURRENT_TIMESTAMP) WHERE id = ?`, userID); err != nil {
+		return err
+	}
+	return RevokeUserSessions(conn, userID)
+}
+
+// UserIDByEmail looks up a user id, returning ErrUserNotFound if none.
+func UserIDByEmail(conn *sql.DB, email string) (string, error) {
+	var id string
+	err := conn.QueryRow(`SELECT id FROM users WHERE email = ?`, NormalizeEmail(email)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return id, err
+}
+
+func updateUser(conn Execer, query string, args ...any) error {
+	res, err := conn.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
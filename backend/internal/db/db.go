@@ -2,8 +2,10 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 func Open(path string) (*sql.DB, error) {
@@ -17,3 +19,9 @@ func Open(path string) (*sql.DB, error) {
 	}
 	return conn, nil
 }
+
+// IsUniqueViolation reports whether err is a UNIQUE constraint failure.
+func IsUniqueViolation(err error) bool {
+	var e sqlite3.Error
+	return errors.As(err, &e) && e.ExtendedCode == sqlite3.ErrConstraintUnique
+}
@@ -1,7 +1,7 @@
 package db
 
-
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -55,25 +55,59 @@ func ApplyMigrations(conn *sql.DB, migrationsDir string) error {
 			return err
 		}
 
-		tx, err := conn.Begin()
-		if err != nil {
+		if err := applyMigration(conn, f, string(sqlBytes)); err != nil {
 			return err
 		}
+	}
 
-		if _, err := tx.Exec(string(sqlBytes)); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("migration %s failed: %w", f, err)
-		}
+	return nil
+}
 
-		if _, err := tx.Exec(`INSERT INTO schema_migrations(filename) VALUES (?)`, f); err != nil {
-			_ = tx.Rollback()
-			return err
-		}
+// applyMigration runs one migration file in a transaction with foreign keys
+// switched off, so a migration can rebuild a table that other tables point at
+// (the only way SQLite can change a column type or constraint). The pragma is
+// a no-op inside a transaction, hence the pinned connection; integrity is
+// re-checked with foreign_key_check before commit.
+func applyMigration(conn *sql.DB, filename, query string) error {
+	ctx := context.Background()
 
-		if err := tx.Commit(); err != nil {
-			return err
-		}
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return err
 	}
+	defer c.Close()
 
-	return nil
+	if _, err := c.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	defer c.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(query); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %s failed: %w", filename, err)
+	}
+
+	rows, err := tx.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	violations := rows.Next()
+	rows.Close()
+	if violations {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %s failed: foreign key check found violations", filename)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_migrations(filename) VALUES (?)`, filename); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"slices"
+	"time"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/money"
+)
+
+type AlertsHandler struct{ DB *sql.DB }
+
+type budgetAlert struct {
+	ID             string     `json:"id"`
+	Month          string     `json:"month"`      // YYYY-MM
+	CategoryID     *string    `json:"categoryId"` // null for the overall budget
+	Category       *string    `json:"category"`
+	Percent        int        `json:"percent"`
+	Spent          money.Fils `json:"spent"`
+	Budget         money.Fils `json:"budget"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt"`
+}
+
+// ListAlerts returns recorded budget alerts, newest first: the in-app
+// notification feed. ?month=YYYY-MM narrows to one month and
+// ?unacknowledged=1 hides alerts already dealt with.
+func (h AlertsHandler) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	query := `
+		SELECT a.id, substr(a.month, 1, 7), a.category_id, c.name, a.percent, a.spent_fils, a.budget_fils, a.created_at, a.acknowledged_at
+		FROM budget_alerts a
+		LEFT JOIN categories c ON c.id = a.category_id
+		WHERE 1 = 1
+	`
+	var args []any
+	if month := r.URL.Query().Get("month"); month != "" {
+		if _, err := time.Parse("2006-01", month); err != nil {
+			httpx.JSON(w, 400, map[string]string{"error": "month must be YYYY-MM"})
+			return
+		}
+		query += ` AND a.month = ?`
+		args = append(args, month+"-01")
+	}
+	if queryFlag(r.URL.Query().Get("unacknowledged")) {
+		query += ` AND a.acknowledged_at IS NULL`
+	}
+	query += ` ORDER BY a.created_at DESC, a.percent DESC LIMIT 200`
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	out := []budgetAlert{}
+	for rows.Next() {
+		var a budgetAlert
+		if err := rows.Scan(&a.ID, &a.Month, &a.CategoryID, &a.Category, &a.Percent, &a.Spent, &a.Budget, &a.CreatedAt, &a.AcknowledgedAt); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		out = append(out, a)
+	}
+	httpx.JSON(w, 200, out)
+}
+
+// AcknowledgeAlert marks an alert as seen for everyone.
+func (h AlertsHandler) AcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "budget_alerts", "id = ?", r.PathValue("id"))
+	res, err := tx.Exec(`
+		UPDATE budget_alerts SET acknowledged_at = COALESCE(acknowledged_at, ?), acknowledged_by = COALESCE(acknowledged_by, ?)
+		WHERE id = ?
+	`, time.Now().UTC(), uid, r.PathValue("id"))
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "alert not found"})
+		return
+	}
+	if !commitAudited(w, r, tx, change, "acknowledge") {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+func (h AlertsHandler) Thresholds(w http.ResponseWriter, r *http.Request) {
+	out, err := thresholdPercents(h.DB)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"percents": out})
+}
+
+type thresholdsReq struct {
+	Percents []int `json:"percents"`
+}
+
+// SetThresholds replaces the alert percentages. An empty list turns budget
+// alerts off.
+func (h AlertsHandler) SetThresholds(w http.ResponseWriter, r *http.Request) {
+	var req thresholdsReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	for _, p := range req.Percents {
+		if p <= 0 || p > 1000 {
+			httpx.JSON(w, 400, map[string]string{"error": "percents must be between 1 and 1000"})
+			return
+		}
+	}
+	slices.Sort(req.Percents)
+	req.Percents = slices.Compact(req.Percents)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := thresholdPercents(tx)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM alert_thresholds`); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	for _, p := range req.Percents {
+		if _, err := tx.Exec(`INSERT INTO alert_thresholds (percent) VALUES (?)`, p); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	err = audit.Write(tx, audit.Entry{
+		Actor:  audit.ActorFrom(r),
+		Action: audit.Update,
+		Entity: "alert_thresholds",
+		Before: map[string]any{"percents": before},
+		After:  map[string]any{"percents": req.Percents},
+	})
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	httpx.JSON(w, 200, map[string]any{"percents": req.Percents})
+}
+
+func thresholdPercents(q audit.DB) ([]int, error) {
+	rows, err := q.Query(`SELECT percent FROM alert_thresholds ORDER BY percent`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []int{}
+	for rows.Next() {
+		var p int
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
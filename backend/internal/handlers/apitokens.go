@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/httpx"
+)
+
+// defaultTokenTTL applies when a token is created without an expiry date.
+const defaultTokenTTL = 90 * 24 * time.Hour
+
+type apiTokenRow struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Scopes     []auth.Permission `json:"scopes"`
+	ExpiresAt  time.Time         `json:"expiresAt"`
+	LastUsedAt *time.Time        `json:"lastUsedAt"`
+	RevokedAt  *time.Time        `json:"revokedAt"`
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+// ListAPITokens returns the signed-in user's tokens, revoked and expired ones
+// included. Token values are never shown again after creation.
+func (h AuthHandler) ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+
+	rows, err := h.DB.Query(`
+		SELECT id, name, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, uid)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	out := []apiTokenRow{}
+	for rows.Next() {
+		var t apiTokenRow
+		var scopes string
+		if err := rows.Scan(&t.ID, &t.Name, &scopes, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		t.Scopes = auth.SplitScopes(scopes)
+		out = append(out, t)
+	}
+
+	httpx.JSON(w, 200, out)
+}
+
+type createAPITokenReq struct {
+	Name      string            `json:"name"`
+	Scopes    []auth.Permission `json:"scopes"`
+	ExpiresAt string            `json:"expiresAt"` // YYYY-MM-DD, optional
+}
+
+// CreateAPIToken issues a token for the signed-in user and returns it once.
+func (h AuthHandler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+
+	var req createAPITokenReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		httpx.JSON(w, 400, map[string]string{"error": "name is required"})
+		return
+	}
+
+	expires := time.Now().Add(defaultTokenTTL)
+	if req.ExpiresAt != "" {
+		d, err := time.Parse("2006-01-02", req.ExpiresAt)
+		if err != nil {
+			httpx.JSON(w, 400, map[string]string{"error": "expiresAt must be YYYY-MM-DD"})
+			return
+		}
+		// Valid through the whole of the given day.
+		expires = d.Add(24 * time.Hour)
+		if !expires.After(time.Now()) {
+			httpx.JSON(w, 400, map[string]string{"error": "expiresAt must be in the future"})
+			return
+		}
+	}
+
+	id, token, err := auth.CreateAPIToken(h.DB, uid, auth.RoleFromContext(r), req.Name, req.Scopes, expires)
+	if errors.Is(err, auth.ErrInvalidScope) {
+		httpx.JSON(w, 400, map[string]string{"error": "scopes must be permissions your role grants"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	httpx.JSON(w, 201, map[string]any{"id": id, "token": token, "expiresAt": expires.UTC()})
+}
+
+// RevokeAPIToken stops one of the user's own tokens from working.
+func (h AuthHandler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+
+	res, err := h.DB.Exec(`
+		UPDATE api_tokens SET revoked_at = ?
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`, time.Now().UTC(), r.PathValue("id"), uid)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "token not found"})
+		return
+	}
+
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/db"
+	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/periods"
+	"almanarteen-backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// MaxAttachmentSize caps a single uploaded file.
+const MaxAttachmentSize = 10 << 20 // 10 MiB
+
+// attachmentTypes are the sniffed content types accepted for receipts and
+// invoices. The client-supplied Content-Type is ignored.
+var attachmentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+}
+
+type attachment struct {
+	ID          string    `json:"id"`
+	ExpenseID   string    `json:"expenseId"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	UploadedBy  string    `json:"uploadedBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+const attachmentSelect = `
+		SELECT a.id, a.expense_id, a.filename, a.content_type, a.size_bytes, a.sha256, u.name, a.created_at
+		FROM attachments a
+		JOIN users u ON u.id = a.uploaded_by
+`
+
+func scanAttachment(s rowScanner, a *attachment) error {
+	return s.Scan(&a.ID, &a.ExpenseID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.UploadedBy, &a.CreatedAt)
+}
+
+func (h ExpensesHandler) ListAttachments(w http.ResponseWriter, r *http.Request) {
+	expenseID := r.PathValue("id")
+
+	if ok, err := h.expenseExists(expenseID); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	} else if !ok {
+		httpx.JSON(w, 404, map[string]string{"error": "expense not found"})
+		return
+	}
+
+	rows, err := h.DB.Query(attachmentSelect+` WHERE a.expense_id = ? ORDER BY a.created_at`, expenseID)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	out := []attachment{}
+	for rows.Next() {
+		var a attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		out = append(out, a)
+	}
+	httpx.JSON(w, 200, out)
+}
+
+// UploadAttachment stores the multipart "file" field against an expense.
+// Uploading the same file to the same expense again returns the existing
+// attachment instead of a duplicate. Expenses in a closed month take no new
+// receipts.
+func (h ExpensesHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserIDFromContext(r)
+	expenseID := r.PathValue("id")
+
+	// Checked again while storing; this only saves reading the upload.
+	date, err := expenseDate(h.DB, expenseID)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "expense not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if !periodOpen(w, h.DB, date) {
+		return
+	}
+
+	// Leave room for the multipart framing around the file itself.
+	r.Body = http.MaxBytesReader(w, r.Body, MaxAttachmentSize+1<<20)
+	f, hdr, err := r.FormFile("file")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			httpx.JSON(w, 413, map[string]string{"error": "file is larger than 10 MB"})
+			return
+		}
+		httpx.JSON(w, 400, map[string]string{"error": "multipart field \"file\" is required"})
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, MaxAttachmentSize+1))
+	if err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+	if len(data) > MaxAttachmentSize {
+		httpx.JSON(w, 413, map[string]string{"error": "file is larger than 10 MB"})
+		return
+	}
+	if len(data) == 0 {
+		httpx.JSON(w, 400, map[string]string{"error": "file is empty"})
+		return
+	}
+
+	ctype, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if !attachmentTypes[ctype] {
+		httpx.JSON(w, 415, map[string]string{"error": "only PDF and image files (JPEG, PNG, GIF, WebP) can be attached"})
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	a := attachment{
+		ID:          uuid.NewString(),
+		ExpenseID:   expenseID,
+		Filename:    attachmentName(hdr.Filename),
+		ContentType: ctype,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+
+	err = h.storeAttachment(a, data, userID, audit.ActorFrom(r))
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "expense not found"})
+		return
+	}
+	if closedMonth(w, err) {
+		return
+	}
+	if db.IsUniqueViolation(err) {
+		err = scanAttachment(h.DB.QueryRow(attachmentSelect+` WHERE a.expense_id = ? AND a.sha256 = ?`, expenseID, a.SHA256), &a)
+		if err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		httpx.JSON(w, 200, a)
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := scanAttachment(h.DB.QueryRow(attachmentSelect+` WHERE a.id = ?`, a.ID), &a); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, 201, a)
+}
+
+// storeAttachment writes the file and inserts a with its audit entry,
+// giving a *periods.ClosedError when the expense's month is closed. The
+// blob lock is held until the row is committed, so releaseBlobs cannot
+// delete the blob between the write and the reference to it. When the row
+// is not stored, the file goes again unless another attachment uses it.
+func (h ExpensesHandler) storeAttachment(a attachment, data []byte, userID string, actor audit.Actor) (err error) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	if err := h.Files.Put(a.SHA256, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			h.deleteUnusedBlobs(a.SHA256)
+		}
+	}()
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	date, err := expenseDate(tx, a.ExpenseID)
+	if err != nil {
+		return err
+	}
+	if err := periods.CheckOpen(tx, date); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO attachments (id, expense_id, filename, content_type, size_bytes, sha256, uploaded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, a.ID, a.ExpenseID, a.Filename, a.ContentType, a.Size, a.SHA256, userID)
+	if err != nil {
+		return err
+	}
+	if err := audit.Inserted("attachments", "id = ?", a.ID).Record(tx, actor, audit.Create); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DownloadAttachment streams the file back with its original name.
+func (h ExpensesHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	var a attachment
+	err := scanAttachment(h.DB.QueryRow(attachmentSelect+` WHERE a.id = ? AND a.expense_id = ?`,
+		r.PathValue("attachmentId"), r.PathValue("id")), &a)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "attachment not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	f, err := h.Files.Open(a.SHA256)
+	if errors.Is(err, storage.ErrNotFound) {
+		httpx.JSON(w, 404, map[string]string{"error": "attachment file is missing"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, _ = io.Copy(w, f)
+}
+
+// DeleteAttachment removes a receipt, unless its expense is in a closed
+// month.
+func (h ExpensesHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	date, err := expenseDate(tx, r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "attachment not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if !periodOpen(w, tx, date) {
+		return
+	}
+
+	change := audit.Track(tx, "attachments", "id = ?", r.PathValue("attachmentId"))
+	var sum string
+	err = tx.QueryRow(`
+		DELETE FROM attachments WHERE id = ? AND expense_id = ?
+		RETURNING sha256
+	`, r.PathValue("attachmentId"), r.PathValue("id")).Scan(&sum)
+	if closedMonth(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "attachment not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Delete) {
+		return
+	}
+	h.releaseBlobs(sum)
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+// blobMu makes storing a blob and inserting the attachment that refers to
+// it one step as far as releaseBlobs is concerned. The API is the only
+// process writing attachments, so a process-wide lock is enough.
+var blobMu sync.Mutex
+
+// releaseBlobs deletes stored files that no attachment refers to any more.
+// Failures only leave an orphaned file behind, so they are logged.
+func (h ExpensesHandler) releaseBlobs(sums ...string) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	h.deleteUnusedBlobs(sums...)
+}
+
+// deleteUnusedBlobs is releaseBlobs for callers already holding blobMu.
+func (h ExpensesHandler) deleteUnusedBlobs(sums ...string) {
+	for _, sum := range sums {
+		var n int
+		if err := h.DB.QueryRow(`SELECT COUNT(1) FROM attachments WHERE sha256 = ?`, sum).Scan(&n); err != nil {
+			log.Printf("attachments: %v", err)
+			continue
+		}
+		if n > 0 {
+			continue
+		}
+		if err := h.Files.Delete(sum); err != nil {
+			log.Printf("attachments: delete blob %s: %v", sum, err)
+		}
+	}
+}
+
+func (h ExpensesHandler) expenseExists(id string) (bool, error) {
+	var n int
+	err := h.DB.QueryRow(`SELECT COUNT(1) FROM expenses WHERE id = ?`, id).Scan(&n)
+	return n > 0, err
+}
+
+// expenseDate returns the purchase date (YYYY-MM-DD) of an expense, or
+// sql.ErrNoRows.
+func expenseDate(q periods.Querier, id string) (string, error) {
+	var date string
+	err := q.QueryRow(`SELECT substr(purchase_date, 1, 10) FROM expenses WHERE id = ?`, id).Scan(&date)
+	return date, err
+}
+
+// attachmentName keeps the base name of an uploaded file, dropping any path
+// a browser may send and control characters that would break headers.
+func attachmentName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
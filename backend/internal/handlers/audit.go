@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/httpx"
+)
+
+// commitAudited logs c in tx and commits tx, so a change is never saved
+// without its audit entry. It answers 500 and returns false when either
+// fails; the caller's deferred Rollback then undoes the change.
+func commitAudited(w http.ResponseWriter, r *http.Request, tx *sql.Tx, c *audit.Change, action string) bool {
+	if err := c.Record(tx, audit.ActorFrom(r), action); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "audit: " + err.Error()})
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+type AuditHandler struct{ DB *sql.DB }
+
+type auditEntry struct {
+	ID       int64           `json:"id"`
+	At       time.Time       `json:"at"`
+	ActorID  *string         `json:"actorId"` // null for changes made by the server
+	Actor    *string         `json:"actor"`
+	IP       *string         `json:"ip"`
+	Action   string          `json:"action"`
+	Entity   string          `json:"entity"`
+	EntityID string          `json:"entityId"`
+	Before   json.RawMessage `json:"before"`
+	After    json.RawMessage `json:"after"`
+}
+
+const maxAuditPage = 500
+
+// ListAudit returns audit log entries, newest first, filtered by entity,
+// entityId, actorId, action and from/to (YYYY-MM-DD, inclusive). At most
+// limit entries (default 100) are returned; when more match, X-Next-Cursor
+// carries the value to pass as cursor= for the next page.
+func (h AuditHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	where := []string{"1 = 1"}
+	var args []any
+	for param, col := range map[string]string{
+		"entity":   "a.entity",
+		"entityId": "a.entity_id",
+		"actorId":  "a.actor_id",
+		"action":   "a.action",
+	} {
+		if v := q.Get(param); v != "" {
+			where = append(where, col+" = ?")
+			args = append(args, v)
+		}
+	}
+	for param, op := range map[string]string{"from": ">=", "to": "<="} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			httpx.JSON(w, 400, map[string]string{"error": "from and to must be YYYY-MM-DD"})
+			return
+		}
+		where = append(where, "substr(a.at, 1, 10) "+op+" ?")
+		args = append(args, v)
+	}
+
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditPage {
+			httpx.JSON(w, 400, map[string]string{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = n
+	}
+	if v := q.Get("cursor"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			httpx.JSON(w, 400, map[string]string{"error": "invalid cursor"})
+			return
+		}
+		where = append(where, "a.id < ?")
+		args = append(args, id)
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT a.id, a.at, a.actor_id, u.name, a.ip, a.action, a.entity, a.entity_id, a.before_json, a.after_json
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.actor_id
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY a.id DESC
+		LIMIT ?
+	`, append(args, limit+1)...)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	out := []auditEntry{}
+	for rows.Next() {
+		if len(out) == limit {
+			w.Header().Set("X-Next-Cursor", strconv.FormatInt(out[len(out)-1].ID, 10))
+			break
+		}
+		var e auditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.At, &e.ActorID, &e.Actor, &e.IP, &e.Action, &e.Entity, &e.EntityID, &before, &after); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		out = append(out, e)
+	}
+
+	httpx.JSON(w, 200, out)
+}
@@ -1,15 +1,35 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"almanarteen-backend/internal/audit"
 	"almanarteen-backend/internal/auth"
 	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/notify"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type AuthHandler struct{ DB *sql.DB }
+type AuthHandler struct {
+	DB       *sql.DB
+	Throttle auth.Throttle
+	MFA      auth.MFA
+	Sessions auth.SessionPolicy
+	Notifier notify.Notifier
+	AppURL   string // frontend base URL used in emailed links
+}
+
+// dummyHash is compared against when the email is unknown so that a failed
+// login takes as long whether or not the account exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
 
 type loginReq struct {
 	Email    string `json:"email"`
@@ -23,37 +43,458 @@ func (h AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var id, name, hash string
-	err := h.DB.QueryRow(`SELECT id, name, password_hash FROM users WHERE email = ?`, req.Email).Scan(&id, &name, &hash)
+	email := auth.NormalizeEmail(req.Email)
+	ip := httpx.ClientIP(r)
+
+	wait, err := h.Throttle.Check(email, ip)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		httpx.JSON(w, 429, map[string]string{"error": "too many login attempts, try again later"})
+		return
+	}
+
+	var id, name, hash, role string
+	var disabled bool
+	err = h.DB.QueryRow(`
+		SELECT id, name, password_hash, role, disabled_at IS NOT NULL
+		FROM users
+		WHERE email = ?
+	`, email).Scan(&id, &name, &hash, &role, &disabled)
 	if err != nil {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(req.Password))
+		h.recordAttempt(email, ip, false)
 		httpx.JSON(w, 401, map[string]string{"error": "invalid credentials"})
 		return
 	}
 
 	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
+		h.recordAttempt(email, ip, false)
 		httpx.JSON(w, 401, map[string]string{"error": "invalid credentials"})
 		return
 	}
 
-	sid, exp, err := auth.CreateSession(h.DB, id, 14)
+	if disabled {
+		h.recordAttempt(email, ip, false)
+		httpx.JSON(w, 403, map[string]string{"error": "account is deactivated"})
+		return
+	}
+
+	mfa, err := h.MFA.Enabled(id)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	if mfa {
+		// second step: POST /auth/login/mfa with this challenge and a code
+		challenge, err := h.MFA.NewChallenge(id)
+		if err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": "db error"})
+			return
+		}
+		// The attempt is recorded once the second factor is checked, so
+		// wrong codes count towards the lockout like wrong passwords.
+		httpx.JSON(w, 200, map[string]any{"mfaRequired": true, "challenge": challenge})
+		return
+	}
+
+	h.recordAttempt(email, ip, true)
+	h.startSession(w, r, id, name, role)
+}
+
+type loginMFAReq struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// LoginMFA is the second login step for users with two-factor enabled.
+func (h AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req loginMFAReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	id, err := h.MFA.ChallengeUser(req.Challenge)
+	if errors.Is(err, auth.ErrInvalidChallenge) {
+		httpx.JSON(w, 401, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+
+	var email, name, role string
+	var disabled bool
+	err = h.DB.QueryRow(`SELECT email, name, role, disabled_at IS NOT NULL FROM users WHERE id = ?`, id).Scan(&email, &name, &role, &disabled)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+
+	// Codes are throttled with the password, per email and per IP.
+	ip := httpx.ClientIP(r)
+	wait, err := h.Throttle.Check(email, ip)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		httpx.JSON(w, 429, map[string]string{"error": "too many login attempts, try again later"})
+		return
+	}
+
+	_, err = h.MFA.CompleteChallenge(req.Challenge, req.Code, req.RecoveryCode)
+	switch {
+	case errors.Is(err, auth.ErrInvalidCode):
+		h.recordAttempt(email, ip, false)
+		httpx.JSON(w, 401, map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, auth.ErrInvalidChallenge):
+		httpx.JSON(w, 401, map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+
+	if disabled {
+		h.recordAttempt(email, ip, false)
+		httpx.JSON(w, 403, map[string]string{"error": "account is deactivated"})
+		return
+	}
+
+	h.recordAttempt(email, ip, true)
+	h.startSession(w, r, id, name, role)
+}
+
+func (h AuthHandler) startSession(w http.ResponseWriter, r *http.Request, id, name, role string) {
+	s, err := auth.CreateSession(h.DB, r, id, h.Sessions.TTL)
 	if err != nil {
 		httpx.JSON(w, 500, map[string]string{"error": "failed to create session"})
 		return
 	}
-	auth.SetSessionCookie(w, sid, exp)
-	httpx.JSON(w, 200, map[string]any{"id": id, "name": name})
+	auth.SetSessionCookie(w, s.Token, s.Expires)
+	httpx.JSON(w, 200, map[string]any{"id": id, "name": name, "role": role, "csrfToken": s.CSRFToken})
+}
+
+func (h AuthHandler) recordAttempt(email, ip string, ok bool) {
+	if err := h.Throttle.Record(email, ip, ok); err != nil {
+		log.Println("login attempt:", err)
+	}
 }
 
 func (h AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 	uid := auth.UserIDFromContext(r)
-	httpx.JSON(w, 200, map[string]string{"userId": uid})
+	role := auth.RoleFromContext(r)
+	mfa, _ := h.MFA.Enabled(uid)
+	httpx.JSON(w, 200, map[string]any{
+		"userId":      uid,
+		"role":        role,
+		"permissions": auth.Roles[role],
+		"mfaEnabled":  mfa,
+		"csrfToken":   auth.CSRFTokenFromContext(r),
+	})
 }
 
 func (h AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	c, _ := r.Cookie(auth.CookieName)
 	if c != nil && c.Value != "" {
-		_, _ = h.DB.Exec(`DELETE FROM sessions WHERE id = ?`, c.Value)
+		_, _ = h.DB.Exec(`DELETE FROM sessions WHERE id = ?`, auth.HashToken(c.Value))
 	}
 	auth.ClearSessionCookie(w)
 	httpx.JSON(w, 200, map[string]string{"ok": "true"})
 }
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// ChangePassword sets a new password for the signed-in user after checking
+// the current one. Other sessions are revoked; the current one survives.
+func (h AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+
+	var req changePasswordReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	if err := auth.ValidatePassword(req.NewPassword); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !h.checkPassword(w, r, uid, req.CurrentPassword, "current password is incorrect") {
+		return
+	}
+
+	newHash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "failed to hash password"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "users", "id = ?", uid)
+	if _, err := tx.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, newHash, uid); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	if err := change.Record(tx, audit.ActorFrom(r), "password"); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ? AND id != ?`, uid, auth.SessionIDFromContext(r)); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+// checkPassword confirms the signed-in user's password before a sensitive
+// change, writing a 403 with msg when it is wrong. Attempts are throttled
+// with logins, so a stolen session cannot be used to guess the password.
+func (h AuthHandler) checkPassword(w http.ResponseWriter, r *http.Request, uid, password, msg string) bool {
+	var email, hash string
+	if err := h.DB.QueryRow(`SELECT email, password_hash FROM users WHERE id = ?`, uid).Scan(&email, &hash); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return false
+	}
+
+	ip := httpx.ClientIP(r)
+	if h.throttled(w, email, ip, "too many password attempts, try again later") {
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		h.recordAttempt(email, ip, false)
+		httpx.JSON(w, 403, map[string]string{"error": msg})
+		return false
+	}
+	h.recordAttempt(email, ip, true)
+	return true
+}
+
+// throttled writes a 429 with msg and returns true when an attempt for
+// email from ip has to wait.
+func (h AuthHandler) throttled(w http.ResponseWriter, email, ip, msg string) bool {
+	wait, err := h.Throttle.Check(email, ip)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return true
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		httpx.JSON(w, 429, map[string]string{"error": msg})
+		return true
+	}
+	return false
+}
+
+type forgotPasswordReq struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword emails a reset link. It answers the same way whether or not
+// the email belongs to an account.
+//
+// Requests are throttled like logins. They count as failures under their
+// own key, so asking for resets slows down further requests for the email
+// but never its sign-in; the per-IP allowance is shared with logins.
+func (h AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	email := auth.NormalizeEmail(req.Email)
+	ip := httpx.ClientIP(r)
+	if h.throttled(w, "reset:"+email, ip, "too many reset requests, try again later") {
+		return
+	}
+	h.recordAttempt("reset:"+email, ip, false)
+
+	var id, name string
+	err := h.DB.QueryRow(`
+		SELECT id, name
+		FROM users
+		WHERE email = ? AND disabled_at IS NULL
+	`, email).Scan(&id, &name)
+	if err == nil {
+		// In the background, so the response takes as long for an unknown
+		// email as for a registered one.
+		go h.sendPasswordReset(id, name, email)
+	} else if err != sql.ErrNoRows {
+		log.Println("forgot password:", err)
+	}
+
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+func (h AuthHandler) sendPasswordReset(userID, name, email string) {
+	token, err := auth.CreatePasswordReset(h.DB, userID, time.Hour)
+	if err != nil {
+		log.Println("forgot password:", err)
+		return
+	}
+
+	link := h.AppURL + "/reset-password?token=" + url.QueryEscape(token)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = h.Notifier.Notify(ctx, notify.Message{
+		To:      email,
+		Subject: "Reset your Almanarteen password",
+		Body: "Hello " + name + ",\n\n" +
+			"Use this link within one hour to choose a new password:\n" + link + "\n\n" +
+			"If you did not ask for this, you can ignore this message.",
+	})
+	if err != nil {
+		log.Println("forgot password: notify:", err)
+	}
+}
+
+type resetPasswordReq struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// ResetPassword consumes a reset token; all sessions of the user are revoked.
+func (h AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	defer tx.Rollback()
+
+	uid, err := auth.PasswordResetUser(tx, req.Token)
+	var change *audit.Change
+	if err == nil {
+		change = audit.Track(tx, "users", "id = ?", uid)
+		err = auth.ConsumePasswordReset(tx, req.Token, req.NewPassword)
+	}
+	switch {
+	case errors.Is(err, auth.ErrWeakPassword), errors.Is(err, auth.ErrInvalidResetToken):
+		httpx.JSON(w, 400, map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+
+	// Nobody is signed in; the reset is attributed to the user it is for.
+	if err := change.Record(tx, audit.Actor{UserID: uid, IP: httpx.ClientIP(r)}, "password reset"); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+// EnrollMFA starts two-factor enrollment and returns the secret and the
+// otpauth URI to show as a QR code.
+func (h AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+
+	var email string
+	if err := h.DB.QueryRow(`SELECT email FROM users WHERE id = ?`, uid).Scan(&email); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+
+	secret, uri, err := h.MFA.Enroll(uid, email)
+	if errors.Is(err, auth.ErrMFAEnabled) {
+		httpx.JSON(w, 409, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+
+	httpx.JSON(w, 200, map[string]any{"secret": secret, "otpauthUri": uri})
+}
+
+type mfaCodeReq struct {
+	Code string `json:"code"`
+}
+
+// ConfirmMFA enables two-factor after a valid code and returns the
+// recovery codes. They are shown only this once.
+func (h AuthHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+
+	var req mfaCodeReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	codes, err := h.MFA.Confirm(uid, req.Code)
+	switch {
+	case errors.Is(err, auth.ErrInvalidCode), errors.Is(err, auth.ErrMFANotEnrolled):
+		httpx.JSON(w, 400, map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, auth.ErrMFAEnabled):
+		httpx.JSON(w, 409, map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+
+	httpx.JSON(w, 200, map[string]any{"recoveryCodes": codes})
+}
+
+type disableMFAReq struct {
+	Password string `json:"password"`
+}
+
+// DisableMFA turns two-factor off after re-checking the password.
+func (h AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+
+	var req disableMFAReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	if !h.checkPassword(w, r, uid, req.Password, "password is incorrect") {
+		return
+	}
+
+	if err := h.MFA.Disable(uid); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": "db error"})
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
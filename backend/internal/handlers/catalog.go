@@ -3,31 +3,58 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"strings"
 
+	"almanarteen-backend/internal/audit"
 	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/db"
 	"almanarteen-backend/internal/httpx"
+
+	"github.com/google/uuid"
 )
 
 type CatalogHandler struct{ DB *sql.DB }
 
+type category struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	ArchivedAt *string `json:"archivedAt,omitempty"`
+}
+
+type item struct {
+	ID         string  `json:"id"`
+	CategoryID string  `json:"categoryId,omitempty"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	ArchivedAt *string `json:"archivedAt,omitempty"`
+}
+
+// includeArchived reports whether a list request asked for archived rows too.
+func includeArchived(r *http.Request) bool {
+	v := r.URL.Query().Get("includeArchived")
+	return v == "1" || v == "true"
+}
+
 func (h CatalogHandler) Categories(w http.ResponseWriter, r *http.Request) {
 	_ = auth.UserIDFromContext(r) // ensure protected middleware passed
 
-	rows, err := h.DB.Query(`SELECT id, name FROM categories ORDER BY name`)
+	query := `SELECT id, name, archived_at FROM categories`
+	if !includeArchived(r) {
+		query += ` WHERE archived_at IS NULL`
+	}
+	query += ` ORDER BY name`
+
+	rows, err := h.DB.Query(query)
 	if err != nil {
 		httpx.JSON(w, 500, map[string]string{"error": "db error"})
 		return
 	}
 	defer rows.Close()
 
-	type Cat struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-	}
-	var out []Cat
+	var out []category
 	for rows.Next() {
-		var c Cat
-		if err := rows.Scan(&c.ID, &c.Name); err == nil {
+		var c category
+		if err := rows.Scan(&c.ID, &c.Name, &c.ArchivedAt); err == nil {
 			out = append(out, c)
 		}
 	}
@@ -43,29 +70,461 @@ func (h CatalogHandler) Items(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := h.DB.Query(`
-		SELECT id, name, unit
+	query := `
+		SELECT id, name, unit, archived_at
 		FROM items
 		WHERE category_id = ?
-		ORDER BY name
-	`, categoryID)
+	`
+	if !includeArchived(r) {
+		query += ` AND archived_at IS NULL`
+	}
+	query += ` ORDER BY name`
+
+	rows, err := h.DB.Query(query, categoryID)
 	if err != nil {
 		httpx.JSON(w, 500, map[string]string{"error": "db error"})
 		return
 	}
 	defer rows.Close()
 
-	type Item struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-		Unit string `json:"unit"`
-	}
-	var out []Item
+	var out []item
 	for rows.Next() {
-		var it Item
-		if err := rows.Scan(&it.ID, &it.Name, &it.Unit); err == nil {
+		var it item
+		if err := rows.Scan(&it.ID, &it.Name, &it.Unit, &it.ArchivedAt); err == nil {
 			out = append(out, it)
 		}
 	}
 	httpx.JSON(w, 200, out)
 }
+
+type categoryReq struct {
+	Name     *string `json:"name"`
+	Archived *bool   `json:"archived"`
+}
+
+func (h CatalogHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	_ = auth.UserIDFromContext(r)
+
+	var req categoryReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" {
+		httpx.JSON(w, 400, map[string]string{"error": "name is required"})
+		return
+	}
+
+	c := category{ID: uuid.NewString(), Name: strings.TrimSpace(*req.Name)}
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "categories", "id = ?", c.ID)
+	_, err = tx.Exec(`INSERT INTO categories (id, name) VALUES (?, ?)`, c.ID, c.Name)
+	if db.IsUniqueViolation(err) {
+		httpx.JSON(w, 409, map[string]string{"error": "a category with this name already exists"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Create) {
+		return
+	}
+	httpx.JSON(w, 201, c)
+}
+
+// UpdateCategory renames a category and/or archives or restores it.
+func (h CatalogHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	_ = auth.UserIDFromContext(r)
+	id := r.PathValue("id")
+
+	var req categoryReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		httpx.JSON(w, 400, map[string]string{"error": "name cannot be empty"})
+		return
+	}
+
+	var c category
+	err := h.DB.QueryRow(`SELECT id, name, archived_at FROM categories WHERE id = ?`, id).Scan(&c.ID, &c.Name, &c.ArchivedAt)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "category not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		c.Name = strings.TrimSpace(*req.Name)
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "categories", "id = ?", id)
+	_, err = tx.Exec(`
+		UPDATE categories
+		SET name = ?,
+			archived_at = CASE WHEN ? IS NULL THEN archived_at WHEN ? THEN COALESCE(archived_at, CURRENT_TIMESTAMP) ELSE NULL END
+		WHERE id = ?
+	`, c.Name, req.Archived, req.Archived, id)
+	if db.IsUniqueViolation(err) {
+		httpx.JSON(w, 409, map[string]string{"error": "a category with this name already exists"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Update) {
+		return
+	}
+
+	if err := h.DB.QueryRow(`SELECT archived_at FROM categories WHERE id = ?`, id).Scan(&c.ArchivedAt); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, 200, c)
+}
+
+// DeleteCategory removes a category together with its unused items and its
+// budgets. It is refused while any of its items is referenced by an expense
+// or a recurring expense; archive the category instead so historical
+// expenses keep their labels.
+func (h CatalogHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	_ = auth.UserIDFromContext(r)
+	id := r.PathValue("id")
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var used int
+	if err := tx.QueryRow(`
+		SELECT COUNT(1)
+		FROM expenses e
+		JOIN items i ON i.id = e.item_id
+		WHERE i.category_id = ?
+	`, id).Scan(&used); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if used > 0 {
+		httpx.JSON(w, 409, map[string]string{"error": "category has items with expenses; archive it instead"})
+		return
+	}
+	if err := tx.QueryRow(`
+		SELECT COUNT(1)
+		FROM recurring_expenses re
+		JOIN items i ON i.id = re.item_id
+		WHERE i.category_id = ?
+	`, id).Scan(&used); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if used > 0 {
+		httpx.JSON(w, 409, map[string]string{"error": "category has items used by a recurring expense; pause/delete it or archive instead"})
+		return
+	}
+
+	changes, err := categoryChanges(tx, id)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Budgets would go with the category anyway; deleting them here puts
+	// them in the audit log.
+	if _, err := tx.Exec(`DELETE FROM category_budgets WHERE category_id = ?`, id); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM items WHERE category_id = ?`, id); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	res, err := tx.Exec(`DELETE FROM categories WHERE id = ?`, id)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "category not found"})
+		return
+	}
+
+	for _, c := range changes {
+		if err := c.Record(tx, audit.ActorFrom(r), audit.Delete); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+type itemReq struct {
+	CategoryID *string `json:"categoryId"`
+	Name       *string `json:"name"`
+	Unit       *string `json:"unit"`
+	Archived   *bool   `json:"archived"`
+}
+
+func (h CatalogHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
+	_ = auth.UserIDFromContext(r)
+
+	var req itemReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	if req.CategoryID == nil || req.Name == nil || req.Unit == nil ||
+		*req.CategoryID == "" || strings.TrimSpace(*req.Name) == "" || strings.TrimSpace(*req.Unit) == "" {
+		httpx.JSON(w, 400, map[string]string{"error": "categoryId, name and unit are required"})
+		return
+	}
+
+	if ok, err := h.categoryExists(*req.CategoryID); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	} else if !ok {
+		httpx.JSON(w, 400, map[string]string{"error": "unknown categoryId"})
+		return
+	}
+
+	it := item{
+		ID:         uuid.NewString(),
+		CategoryID: *req.CategoryID,
+		Name:       strings.TrimSpace(*req.Name),
+		Unit:       strings.TrimSpace(*req.Unit),
+	}
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "items", "id = ?", it.ID)
+	_, err = tx.Exec(`
+		INSERT INTO items (id, category_id, name, unit)
+		VALUES (?, ?, ?, ?)
+	`, it.ID, it.CategoryID, it.Name, it.Unit)
+	if db.IsUniqueViolation(err) {
+		httpx.JSON(w, 409, map[string]string{"error": "an item with this name already exists in the category"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Create) {
+		return
+	}
+	httpx.JSON(w, 201, it)
+}
+
+// UpdateItem renames an item, changes its unit or category, and/or archives
+// or restores it. The unit can only change while no expense or pack uses
+// the item, since their quantities are in that unit.
+func (h CatalogHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	_ = auth.UserIDFromContext(r)
+	id := r.PathValue("id")
+
+	var req itemReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	if (req.Name != nil && strings.TrimSpace(*req.Name) == "") || (req.Unit != nil && strings.TrimSpace(*req.Unit) == "") {
+		httpx.JSON(w, 400, map[string]string{"error": "name and unit cannot be empty"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var it item
+	err = tx.QueryRow(`SELECT id, category_id, name, unit FROM items WHERE id = ?`, id).Scan(&it.ID, &it.CategoryID, &it.Name, &it.Unit)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "item not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.CategoryID != nil && *req.CategoryID != it.CategoryID {
+		if ok, err := h.categoryExists(*req.CategoryID); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		} else if !ok {
+			httpx.JSON(w, 400, map[string]string{"error": "unknown categoryId"})
+			return
+		}
+		it.CategoryID = *req.CategoryID
+	}
+	if req.Name != nil {
+		it.Name = strings.TrimSpace(*req.Name)
+	}
+	oldUnit := it.Unit
+	if req.Unit != nil {
+		it.Unit = strings.TrimSpace(*req.Unit)
+	}
+
+	change := audit.Track(tx, "items", "id = ?", id)
+	_, err = tx.Exec(`
+		UPDATE items
+		SET category_id = ?, name = ?, unit = ?,
+			archived_at = CASE WHEN ? IS NULL THEN archived_at WHEN ? THEN COALESCE(archived_at, CURRENT_TIMESTAMP) ELSE NULL END
+		WHERE id = ?
+	`, it.CategoryID, it.Name, it.Unit, req.Archived, req.Archived, id)
+	if db.IsUniqueViolation(err) {
+		httpx.JSON(w, 409, map[string]string{"error": "an item with this name already exists in the category"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Checked after the update, once the transaction holds the write lock,
+	// so no expense, pack or template can be added in between.
+	if !strings.EqualFold(it.Unit, oldUnit) {
+		var used int
+		err := tx.QueryRow(`
+			SELECT (SELECT COUNT(1) FROM expenses WHERE item_id = ?)
+				+ (SELECT COUNT(1) FROM item_packs WHERE item_id = ?)
+				+ (SELECT COUNT(1) FROM recurring_expenses WHERE item_id = ?)
+		`, id, id, id).Scan(&used)
+		if err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		if used > 0 {
+			httpx.JSON(w, 409, map[string]string{"error": "item has expenses, packs or recurring expenses in " + oldUnit + "; its unit cannot change"})
+			return
+		}
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Update) {
+		return
+	}
+
+	if err := h.DB.QueryRow(`SELECT archived_at FROM items WHERE id = ?`, id).Scan(&it.ArchivedAt); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, 200, it)
+}
+
+// DeleteItem removes an item that no expense or recurring expense refers
+// to; used items must be archived instead.
+func (h CatalogHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	_ = auth.UserIDFromContext(r)
+	id := r.PathValue("id")
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var used int
+	if err := tx.QueryRow(`SELECT COUNT(1) FROM expenses WHERE item_id = ?`, id).Scan(&used); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if used > 0 {
+		httpx.JSON(w, 409, map[string]string{"error": "item has expenses; archive it instead"})
+		return
+	}
+	if err := tx.QueryRow(`SELECT COUNT(1) FROM recurring_expenses WHERE item_id = ?`, id).Scan(&used); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if used > 0 {
+		httpx.JSON(w, 409, map[string]string{"error": "item is used by a recurring expense; pause/delete it or archive instead"})
+		return
+	}
+
+	change := audit.Track(tx, "items", "id = ?", id)
+	res, err := tx.Exec(`DELETE FROM items WHERE id = ?`, id)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "item not found"})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Delete) {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+// categoryChanges tracks a category and each of its items and budgets
+// ahead of deleting them.
+func categoryChanges(tx *sql.Tx, id string) ([]*audit.Change, error) {
+	changes := []*audit.Change{audit.Track(tx, "categories", "id = ?", id)}
+	for _, table := range []string{"items", "category_budgets"} {
+		rows, err := tx.Query(`SELECT id FROM `+table+` WHERE category_id = ?`, id)
+		if err != nil {
+			return nil, err
+		}
+		var ids []string
+		for rows.Next() {
+			var rowID string
+			if err := rows.Scan(&rowID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids = append(ids, rowID)
+		}
+		rows.Close()
+
+		for _, rowID := range ids {
+			changes = append(changes, audit.Track(tx, table, "id = ?", rowID))
+		}
+	}
+	return changes, nil
+}
+
+func (h CatalogHandler) categoryExists(id string) (bool, error) {
+	var n int
+	err := h.DB.QueryRow(`SELECT COUNT(1) FROM categories WHERE id = ?`, id).Scan(&n)
+	return n > 0, err
+}
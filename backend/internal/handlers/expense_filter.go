@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"almanarteen-backend/internal/money"
+)
+
+// expenseFilter is the set of query parameters that select expenses, shared
+// by the list and export endpoints. Zero fields do not filter.
+type expenseFilter struct {
+	From       string // YYYY-MM-DD, inclusive
+	To         string // YYYY-MM-DD, inclusive
+	CategoryID string
+	ItemID     string
+	SupplierID string
+	CreatedBy  string // user id
+	Min, Max   *money.Fils
+	Q          string // matched against item name and note
+}
+
+// parseExpenseFilter reads a filter from the query string. month=YYYY-MM is
+// shorthand for the from/to range covering that month.
+func parseExpenseFilter(q url.Values) (expenseFilter, error) {
+	f := expenseFilter{
+		From:       q.Get("from"),
+		To:         q.Get("to"),
+		CategoryID: q.Get("categoryId"),
+		ItemID:     q.Get("itemId"),
+		SupplierID: q.Get("supplierId"),
+		CreatedBy:  q.Get("createdBy"),
+		Q:          strings.TrimSpace(q.Get("q")),
+	}
+
+	if month := q.Get("month"); month != "" {
+		m, err := time.Parse("2006-01", month)
+		if err != nil {
+			return f, errors.New("month must be YYYY-MM")
+		}
+		if f.From != "" || f.To != "" {
+			return f, errors.New("use either month or from/to, not both")
+		}
+		f.From = m.Format("2006-01-02")
+		f.To = m.AddDate(0, 1, -1).Format("2006-01-02")
+	}
+	for _, d := range []string{f.From, f.To} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return f, errors.New("from and to must be YYYY-MM-DD")
+		}
+	}
+	if f.From != "" && f.To != "" && f.From > f.To {
+		return f, errors.New("from must not be after to")
+	}
+
+	for name, dst := range map[string]**money.Fils{"min": &f.Min, "max": &f.Max} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		a, err := money.Parse(v)
+		if err != nil {
+			return f, errors.New(name + ": " + err.Error())
+		}
+		*dst = &a
+	}
+
+	return f, nil
+}
+
+// where returns the SQL condition for f (against the expenseRowFrom aliases)
+// and its arguments.
+func (f expenseFilter) where() (string, []any) {
+	conds := []string{"1 = 1"}
+	var args []any
+
+	add := func(cond string, v any) {
+		conds = append(conds, cond)
+		args = append(args, v)
+	}
+	// Dates compare against the raw column so its index applies; the bound
+	// is the day after To so dates stored with a time still match.
+	if f.From != "" {
+		add("e.purchase_date >= ?", f.From)
+	}
+	if f.To != "" {
+		to, _ := time.Parse("2006-01-02", f.To)
+		add("e.purchase_date < ?", to.AddDate(0, 0, 1).Format("2006-01-02"))
+	}
+	if f.CategoryID != "" {
+		add("c.id = ?", f.CategoryID)
+	}
+	if f.ItemID != "" {
+		add("e.item_id = ?", f.ItemID)
+	}
+	if f.SupplierID != "" {
+		add("e.supplier_id = ?", f.SupplierID)
+	}
+	if f.CreatedBy != "" {
+		add("e.created_by = ?", f.CreatedBy)
+	}
+	if f.Min != nil {
+		add("e.total_price_fils >= ?", *f.Min)
+	}
+	if f.Max != nil {
+		add("e.total_price_fils <= ?", *f.Max)
+	}
+	if f.Q != "" {
+		like := "%" + likeEscaper.Replace(f.Q) + "%"
+		conds = append(conds, `(i.name LIKE ? ESCAPE '\' OR e.note LIKE ? ESCAPE '\')`)
+		args = append(args, like, like)
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// expenseSorts maps the sort= values to their key columns. e.id is always
+// appended as the final tie-breaker so keyset pagination is stable.
+var expenseSorts = map[string][]string{
+	"date":     {"substr(e.purchase_date, 1, 10)", "CAST(e.created_at AS TEXT)"},
+	"total":    {"e.total_price_fils"},
+	"item":     {"i.name"},
+	"category": {"c.name"},
+	"supplier": {"COALESCE(s.name, '')"},
+}
+
+// expensePage is the sort order and page requested by a list call.
+type expensePage struct {
+	Sort  string
+	Desc  bool
+	Limit int
+	After []any // key of the last row of the previous page
+}
+
+const (
+	defaultExpensePage = 100
+	maxExpensePage     = 500
+)
+
+func parseExpensePage(q url.Values) (expensePage, error) {
+	p := expensePage{Sort: q.Get("sort"), Desc: true, Limit: defaultExpensePage}
+	if p.Sort == "" {
+		p.Sort = "date"
+	}
+	if _, ok := expenseSorts[p.Sort]; !ok {
+		return p, errors.New("sort must be one of date, total, item, category, supplier")
+	}
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		p.Desc = false
+	default:
+		return p, errors.New("order must be asc or desc")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxExpensePage {
+			return p, errors.New("limit must be between 1 and 500")
+		}
+		p.Limit = n
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		var cur pageCursor
+		b, err := base64.RawURLEncoding.DecodeString(c)
+		if err == nil {
+			err = json.Unmarshal(b, &cur)
+		}
+		if err != nil || cur.Sort != p.Sort || cur.Desc != p.Desc || len(cur.Key) != len(expenseSorts[p.Sort])+1 {
+			return p, errors.New("invalid cursor")
+		}
+		for _, v := range cur.Key {
+			switch v.(type) {
+			case string, float64:
+			default:
+				return p, errors.New("invalid cursor")
+			}
+		}
+		p.After = cur.Key
+	}
+
+	return p, nil
+}
+
+// pageCursor is the opaque X-Next-Cursor value. It carries the sort so a
+// cursor cannot be replayed against a different ordering.
+type pageCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d"`
+	Key  []any  `json:"k"`
+}
+
+// keyColumns returns the sort key expressions, tie-breaker included.
+func (p expensePage) keyColumns() []string {
+	return append(append([]string{}, expenseSorts[p.Sort]...), "e.id")
+}
+
+// orderBy returns the ORDER BY clause for p.
+func (p expensePage) orderBy() string {
+	dir := " ASC"
+	if p.Desc {
+		dir = " DESC"
+	}
+	cols := p.keyColumns()
+	for i := range cols {
+		cols[i] += dir
+	}
+	return " ORDER BY " + strings.Join(cols, ", ")
+}
+
+// seek returns the keyset condition that starts the page after p.After.
+func (p expensePage) seek() (string, []any) {
+	if p.After == nil {
+		return "", nil
+	}
+	op := ">"
+	if p.Desc {
+		op = "<"
+	}
+	cols := p.keyColumns()
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+	return " AND (" + strings.Join(cols, ", ") + ") " + op + " (" + marks + ")", p.After
+}
+
+// nextCursor encodes key, the sort key of the last row returned.
+func (p expensePage) nextCursor(key []any) string {
+	b, _ := json.Marshal(pageCursor{Sort: p.Sort, Desc: p.Desc, Key: key})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseExpensePage(t *testing.T) {
+	tests := []struct {
+		query string
+		want  expensePage
+		ok    bool
+	}{
+		{"", expensePage{Sort: "date", Desc: true, Limit: defaultExpensePage}, true},
+		{"sort=total&order=asc&limit=500", expensePage{Sort: "total", Limit: 500}, true},
+		{"sort=supplier&order=desc&limit=1", expensePage{Sort: "supplier", Desc: true, Limit: 1}, true},
+
+		{"sort=price", expensePage{}, false},
+		{"order=up", expensePage{}, false},
+		{"limit=0", expensePage{}, false},
+		{"limit=501", expensePage{}, false},
+		{"limit=ten", expensePage{}, false},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		got, err := parseExpensePage(q)
+		if tt.ok && (err != nil || !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("parseExpensePage(%q) = %+v, %v; want %+v", tt.query, got, err, tt.want)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("parseExpensePage(%q) = %+v; want error", tt.query, got)
+		}
+	}
+}
+
+func TestExpenseCursor(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	date := expensePage{Sort: "date", Desc: true}
+	total := expensePage{Sort: "total"}
+
+	tests := []struct {
+		name   string
+		query  string // without the cursor
+		cursor string
+		after  []any // nil when the cursor must be refused
+	}{
+		{
+			"date round trip", "",
+			date.nextCursor([]any{"2026-01-09", "2026-01-09 10:00:00", "e1"}),
+			[]any{"2026-01-09", "2026-01-09 10:00:00", "e1"},
+		},
+		{
+			// Numbers come back from JSON as float64.
+			"total round trip", "sort=total&order=asc",
+			total.nextCursor([]any{int64(1235), "e1"}),
+			[]any{float64(1235), "e1"},
+		},
+		{"other sort", "sort=total", date.nextCursor([]any{"2026-01-09", "x", "e1"}), nil},
+		{"other order", "order=asc", date.nextCursor([]any{"2026-01-09", "x", "e1"}), nil},
+		{"short key", "", date.nextCursor([]any{"2026-01-09", "e1"}), nil},
+		{"object in key", "", encode(`{"s":"date","d":true,"k":["2026-01-09",{},"e1"]}`), nil},
+		{"null in key", "", encode(`{"s":"date","d":true,"k":["2026-01-09",null,"e1"]}`), nil},
+		{"not base64", "", "%%%", nil},
+		{"not json", "", encode("date"), nil},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		q.Set("cursor", tt.cursor)
+		got, err := parseExpensePage(q)
+		if tt.after == nil {
+			if err == nil {
+				t.Errorf("%s: cursor accepted as %v; want error", tt.name, got.After)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got.After, tt.after) {
+			t.Errorf("%s: After = %v, %v; want %v", tt.name, got.After, err, tt.after)
+		}
+	}
+}
+
+func TestExpenseFilterDates(t *testing.T) {
+	tests := []struct {
+		query string
+		args  []any
+		ok    bool
+	}{
+		{"from=2026-01-01&to=2026-01-31", []any{"2026-01-01", "2026-02-01"}, true},
+		{"month=2026-02", []any{"2026-02-01", "2026-03-01"}, true},
+		{"to=2026-12-31", []any{"2027-01-01"}, true},
+
+		{"month=2026-13", nil, false},
+		{"month=2026-02&from=2026-02-01", nil, false},
+		{"from=2026-02-30", nil, false},
+		{"from=2026-02-02&to=2026-02-01", nil, false},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		f, err := parseExpenseFilter(q)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("parseExpenseFilter(%q) succeeded; want error", tt.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseExpenseFilter(%q): %v", tt.query, err)
+			continue
+		}
+		if _, args := f.where(); !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("parseExpenseFilter(%q).where() args = %v; want %v", tt.query, args, tt.args)
+		}
+	}
+}
@@ -2,34 +2,166 @@ package handlers
 
 import (
 	"database/sql"
-	"math"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"almanarteen-backend/internal/alerts"
+	"almanarteen-backend/internal/audit"
 	"almanarteen-backend/internal/auth"
 	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/ledger"
+	"almanarteen-backend/internal/money"
+	"almanarteen-backend/internal/periods"
+	"almanarteen-backend/internal/prices"
+	"almanarteen-backend/internal/storage"
+	"almanarteen-backend/internal/units"
+	"almanarteen-backend/internal/vat"
 
 	"github.com/google/uuid"
 )
 
-type ExpensesHandler struct{ DB *sql.DB }
+type ExpensesHandler struct {
+	DB     *sql.DB
+	Files  storage.Store     // receipts and invoices attached to expenses
+	Alerts *alerts.Evaluator // budget alerts; may be nil
+	Prices prices.Policy     // unusual unit price check; zero disables it
+}
 
 type createExpenseReq struct {
-	Date      string  `json:"date"` // YYYY-MM-DD
-	ItemID    string  `json:"itemId"`
-	Quantity  float64 `json:"quantity"`
-	UnitPrice float64 `json:"unitPrice"`
-	Note      string  `json:"note"`
+	Date       string     `json:"date"` // YYYY-MM-DD
+	ItemID     string     `json:"itemId"`
+	Quantity   float64    `json:"quantity"`
+	Unit       string     `json:"unit"`      // optional; a standard unit or one of the item's packs
+	UnitPrice  money.Fils `json:"unitPrice"` // per Unit
+	Note       string     `json:"note"`
+	SupplierID string     `json:"supplierId"` // optional
+	// VATCategory defaults to exempt. With VATInclusive the unit price
+	// already contains the VAT; otherwise VAT is added on top.
+	VATCategory  vat.Category `json:"vatCategory"`
+	VATInclusive bool         `json:"vatInclusive"`
+	// ConfirmPrice records a unit price that the price check would
+	// otherwise hold back for confirmation.
+	ConfirmPrice bool `json:"confirmPrice"`
 }
 
-func round2(x float64) float64 { return math.Round(x*100) / 100 }
+// decodeError turns a request decoding failure into a client message,
+// surfacing bad money amounts instead of a generic "invalid json".
+func decodeError(err error) string {
+	if errors.Is(err, money.ErrInvalid) {
+		return err.Error()
+	}
+	return "invalid json"
+}
+
+// expenseRow is the shape returned by ListExpenses and GetExpense.
+type expenseRow struct {
+	ID           string       `json:"id"`
+	Date         string       `json:"date"`
+	CategoryID   string       `json:"categoryId"`
+	Category     string       `json:"category"`
+	Item         string       `json:"item"`
+	Unit         string       `json:"unit"`
+	Quantity     float64      `json:"quantity"`
+	UnitPrice    money.Fils   `json:"unitPrice"`
+	Total        money.Fils   `json:"total"` // gross amount paid: Net + VAT
+	Net          money.Fils   `json:"net"`
+	VAT          money.Fils   `json:"vat"`
+	VATCategory  vat.Category `json:"vatCategory"`
+	VATRate      float64      `json:"vatRate"` // percent, e.g. 10
+	VATInclusive bool         `json:"vatInclusive"`
+	Note         string       `json:"note"`
+	SupplierID   *string      `json:"supplierId"`
+	Supplier     *string      `json:"supplier"`
+	Attachments  int          `json:"attachments"`
+	CreatedBy    string       `json:"createdBy"`
+	// Set when the expense was entered in a unit other than the item's;
+	// Quantity and UnitPrice are always in the item's unit.
+	EnteredQuantity  *float64    `json:"enteredQuantity"`
+	EnteredUnit      *string     `json:"enteredUnit"`
+	EnteredUnitPrice *money.Fils `json:"enteredUnitPrice"`
+	RecurringID      *string     `json:"recurringId"` // template that recorded it
+}
+
+const expenseRowColumns = `
+			e.id,
+			e.purchase_date,
+			c.id,
+			c.name,
+			i.name,
+			i.unit,
+			e.quantity,
+			e.unit_price_fils,
+			e.total_price_fils,
+			e.net_fils,
+			e.vat_fils,
+			e.vat_category,
+			e.vat_rate_bp / 100.0,
+			e.vat_inclusive,
+			COALESCE(e.note, ''),
+			s.id,
+			s.name,
+			(SELECT COUNT(1) FROM attachments a WHERE a.expense_id = e.id),
+			u.name,
+			e.entered_quantity,
+			e.entered_unit,
+			e.entered_unit_price_fils,
+			e.recurring_id
+`
+
+const expenseRowFrom = `
+		FROM expenses e
+		JOIN items i ON i.id = e.item_id
+		JOIN categories c ON c.id = i.category_id
+		JOIN users u ON u.id = e.created_by
+		LEFT JOIN suppliers s ON s.id = e.supplier_id
+`
+
+// expenseRowSelect selects expenseRow columns; append a WHERE clause.
+const expenseRowSelect = `SELECT ` + expenseRowColumns + expenseRowFrom
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanExpenseRow scans the expenseRowColumns into x, followed by any extra
+// columns the query selected.
+func scanExpenseRow(s rowScanner, x *expenseRow, extra ...any) error {
+	return s.Scan(append([]any{
+		&x.ID,
+		&x.Date,
+		&x.CategoryID,
+		&x.Category,
+		&x.Item,
+		&x.Unit,
+		&x.Quantity,
+		&x.UnitPrice,
+		&x.Total,
+		&x.Net,
+		&x.VAT,
+		&x.VATCategory,
+		&x.VATRate,
+		&x.VATInclusive,
+		&x.Note,
+		&x.SupplierID,
+		&x.Supplier,
+		&x.Attachments,
+		&x.CreatedBy,
+		&x.EnteredQuantity,
+		&x.EnteredUnit,
+		&x.EnteredUnitPrice,
+		&x.RecurringID,
+	}, extra...)...)
+}
 
 func (h ExpensesHandler) CreateExpense(w http.ResponseWriter, r *http.Request) {
 	userID := auth.UserIDFromContext(r)
 
 	var req createExpenseReq
 	if err := httpx.DecodeJSON(r, &req); err != nil {
-		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		httpx.JSON(w, 400, map[string]string{"error": decodeError(err)})
 		return
 	}
 
@@ -43,63 +175,126 @@ func (h ExpensesHandler) CreateExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	total := round2(req.Quantity * req.UnitPrice)
+	if req.VATCategory == "" {
+		req.VATCategory = vat.Exempt
+	}
+	if !req.VATCategory.Valid() {
+		httpx.JSON(w, 400, map[string]string{"error": vat.ErrInvalidCategory.Error()})
+		return
+	}
 
-	id := uuid.NewString()
-	_, err := h.DB.Exec(`
-		INSERT INTO expenses (id, purchase_date, item_id, quantity, unit_price, total_price, note, created_by)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, id, req.Date, req.ItemID, req.Quantity, req.UnitPrice, total, req.Note, userID)
+	if !periodOpen(w, h.DB, req.Date) {
+		return
+	}
+
+	if req.SupplierID != "" {
+		if ok, err := h.supplierExists(req.SupplierID); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		} else if !ok {
+			httpx.JSON(w, 400, map[string]string{"error": "unknown supplierId"})
+			return
+		}
+	}
+
+	n, err := ledger.Normalize(h.DB, ledger.Expense{ItemID: req.ItemID, Quantity: req.Quantity, Unit: req.Unit, UnitPrice: req.UnitPrice})
+	if msg, ok := unitError(err); ok {
+		httpx.JSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// An unusual unit price is reported with the new expense, or held back
+	// until confirmed when the policy asks for that. Prices are compared in
+	// the item's unit.
+	priceCheck, err := h.Prices.Check(h.DB, req.ItemID, req.Date, n.UnitPrice)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if priceCheck != nil && h.Prices.RequireConfirmation && !req.ConfirmPrice {
+		httpx.JSON(w, 409, map[string]any{
+			"error":      priceCheck.String() + "; resend with confirmPrice to record it",
+			"priceCheck": priceCheck,
+		})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	id, amounts, err := ledger.Insert(tx, ledger.Expense{
+		Date:         req.Date,
+		ItemID:       req.ItemID,
+		Quantity:     req.Quantity,
+		Unit:         req.Unit,
+		UnitPrice:    req.UnitPrice,
+		Note:         req.Note,
+		SupplierID:   req.SupplierID,
+		VATCategory:  req.VATCategory,
+		VATInclusive: req.VATInclusive,
+		CreatedBy:    userID,
+	})
+	if closedMonth(w, err) {
+		return
+	}
 	if err != nil {
 		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
 		return
 	}
 
-	httpx.JSON(w, 201, map[string]any{"id": id, "total": total})
+	if !commitAudited(w, r, tx, audit.Inserted("expenses", "id = ?", id), audit.Create) {
+		return
+	}
+	h.Alerts.ForExpense(req.Date, req.ItemID)
+	httpx.JSON(w, 201, map[string]any{"id": id, "total": amounts.Total, "net": amounts.Net, "vat": amounts.VAT, "priceCheck": priceCheck})
 }
 
+// ListExpenses returns the expenses matching the filter query parameters
+// (see parseExpenseFilter), sorted by sort=date|total|item|category|supplier
+// and order=asc|desc (newest first by default).
+//
+// The response holds at most limit rows (100 unless given, at most 500) and,
+// when there are more, X-Next-Cursor carries the value to pass as cursor= for
+// the next page. X-Total-Count is always the number of
+// matches across all pages.
 func (h ExpensesHandler) ListExpenses(w http.ResponseWriter, r *http.Request) {
 	_ = auth.UserIDFromContext(r)
 
-	month := r.URL.Query().Get("month") // YYYY-MM
-	if month == "" {
-		httpx.JSON(w, 400, map[string]string{"error": "month is required (YYYY-MM)"})
+	f, err := parseExpenseFilter(r.URL.Query())
+	if err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": err.Error()})
 		return
 	}
-	if _, err := time.Parse("2006-01", month); err != nil {
-		httpx.JSON(w, 400, map[string]string{"error": "month must be YYYY-MM"})
+	page, err := parseExpensePage(r.URL.Query())
+	if err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": err.Error()})
 		return
 	}
 
-	categoryID := r.URL.Query().Get("categoryId")
-
-	query := `
-		SELECT 
-			e.id,
-			e.purchase_date,
-			c.id,
-			c.name,
-			i.name,
-			i.unit,
-			e.quantity,
-			e.unit_price,
-			e.total_price,
-			e.note,
-			u.name
-		FROM expenses e
-		JOIN items i ON i.id = e.item_id
-		JOIN categories c ON c.id = i.category_id
-		JOIN users u ON u.id = e.created_by
-		WHERE substr(e.purchase_date,1,7) = ?
-	`
-	args := []any{month}
+	where, args := f.where()
 
-	if categoryID != "" {
-		query += ` AND c.id = ? `
-		args = append(args, categoryID)
+	var count int
+	if err := h.DB.QueryRow(`SELECT COUNT(1) `+expenseRowFrom+` WHERE `+where, args...).Scan(&count); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
 	}
 
-	query += ` ORDER BY e.purchase_date DESC, e.created_at DESC`
+	keyCols := page.keyColumns()
+	query := `SELECT ` + expenseRowColumns + `, ` + strings.Join(keyCols, ", ") + expenseRowFrom + ` WHERE ` + where
+	seek, seekArgs := page.seek()
+	query += seek + page.orderBy()
+	args = append(args, seekArgs...)
+	// One extra row tells whether another page follows.
+	query += ` LIMIT ?`
+	args = append(args, page.Limit+1)
 
 	rows, err := h.DB.Query(query, args...)
 	if err != nil {
@@ -108,58 +303,291 @@ func (h ExpensesHandler) ListExpenses(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	type Row struct {
-		ID         string  `json:"id"`
-		Date       string  `json:"date"`
-		CategoryID string  `json:"categoryId"`
-		Category   string  `json:"category"`
-		Item       string  `json:"item"`
-		Unit       string  `json:"unit"`
-		Quantity   float64 `json:"quantity"`
-		UnitPrice  float64 `json:"unitPrice"`
-		Total      float64 `json:"total"`
-		Note       string  `json:"note"`
-		CreatedBy  string  `json:"createdBy"`
-	}
-
-	out := []Row{}
+	out := []expenseRow{}
+	var lastKey []any
 	for rows.Next() {
-		var x Row
-		if err := rows.Scan(
-			&x.ID,
-			&x.Date,
-			&x.CategoryID,
-			&x.Category,
-			&x.Item,
-			&x.Unit,
-			&x.Quantity,
-			&x.UnitPrice,
-			&x.Total,
-			&x.Note,
-			&x.CreatedBy,
-		); err != nil {
+		if len(out) == page.Limit {
+			w.Header().Set("X-Next-Cursor", page.nextCursor(lastKey))
+			break
+		}
+
+		var x expenseRow
+		key := make([]any, len(keyCols))
+		dest := make([]any, len(key))
+		for i := range key {
+			dest[i] = &key[i]
+		}
+		if err := scanExpenseRow(rows, &x, dest...); err != nil {
 			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
 			return
 		}
+		for i, v := range key {
+			if b, ok := v.([]byte); ok {
+				key[i] = string(b)
+			}
+		}
 		out = append(out, x)
+		lastKey = key
 	}
 
+	w.Header().Set("X-Total-Count", strconv.Itoa(count))
 	httpx.JSON(w, 200, out)
 }
 
+// updateExpenseReq holds the fields of an expense that can be changed.
+// Nil fields are left untouched by PATCH; PUT requires all of them.
+type updateExpenseReq struct {
+	Date      *string     `json:"date"` // YYYY-MM-DD
+	ItemID    *string     `json:"itemId"`
+	Quantity  *float64    `json:"quantity"`
+	Unit      *string     `json:"unit"` // empty for the item's unit
+	UnitPrice *money.Fils `json:"unitPrice"`
+	Note      *string     `json:"note"`
+	// SupplierID links a supplier; an empty string unlinks it.
+	SupplierID   *string       `json:"supplierId"`
+	VATCategory  *vat.Category `json:"vatCategory"`
+	VATInclusive *bool         `json:"vatInclusive"`
+}
+
+func (h ExpensesHandler) GetExpense(w http.ResponseWriter, r *http.Request) {
+	_ = auth.UserIDFromContext(r)
+
+	var x expenseRow
+	err := scanExpenseRow(h.DB.QueryRow(expenseRowSelect+` WHERE e.id = ?`, r.PathValue("id")), &x)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "expense not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	httpx.JSON(w, 200, x)
+}
+
+func (h ExpensesHandler) UpdateExpense(w http.ResponseWriter, r *http.Request) {
+	_ = auth.UserIDFromContext(r)
+	id := r.PathValue("id")
+
+	var req updateExpenseReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": decodeError(err)})
+		return
+	}
+
+	if r.Method == "PUT" && (req.Date == nil || req.ItemID == nil || req.Quantity == nil || req.UnitPrice == nil) {
+		httpx.JSON(w, 400, map[string]string{"error": "missing/invalid fields"})
+		return
+	}
+
+	// The month checks run on the transaction that writes, so a month closed
+	// meanwhile cannot take the change.
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var cur createExpenseReq
+	var rate int64
+	err = tx.QueryRow(`
+		SELECT substr(purchase_date, 1, 10), item_id,
+			COALESCE(entered_quantity, quantity), COALESCE(entered_unit, ''), COALESCE(entered_unit_price_fils, unit_price_fils),
+			COALESCE(note, ''), COALESCE(supplier_id, ''), vat_category, vat_rate_bp, vat_inclusive
+		FROM expenses
+		WHERE id = ?
+	`, id).Scan(&cur.Date, &cur.ItemID, &cur.Quantity, &cur.Unit, &cur.UnitPrice, &cur.Note, &cur.SupplierID,
+		&cur.VATCategory, &rate, &cur.VATInclusive)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "expense not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if !periodOpen(w, tx, cur.Date) {
+		return
+	}
+
+	if req.Date != nil {
+		cur.Date = *req.Date
+	}
+	if req.ItemID != nil {
+		cur.ItemID = *req.ItemID
+	}
+	if req.Quantity != nil {
+		cur.Quantity = *req.Quantity
+	}
+	if req.Unit != nil {
+		cur.Unit = *req.Unit
+	}
+	if req.UnitPrice != nil {
+		cur.UnitPrice = *req.UnitPrice
+	}
+	if req.Note != nil {
+		cur.Note = *req.Note
+	}
+	if req.SupplierID != nil && *req.SupplierID != cur.SupplierID {
+		if *req.SupplierID != "" {
+			if ok, err := h.supplierExists(*req.SupplierID); err != nil {
+				httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+				return
+			} else if !ok {
+				httpx.JSON(w, 400, map[string]string{"error": "unknown supplierId"})
+				return
+			}
+		}
+		cur.SupplierID = *req.SupplierID
+	}
+	// The stored rate is kept unless the category changes, so editing an old
+	// expense does not re-rate it.
+	if req.VATCategory != nil && *req.VATCategory != cur.VATCategory {
+		if !req.VATCategory.Valid() {
+			httpx.JSON(w, 400, map[string]string{"error": vat.ErrInvalidCategory.Error()})
+			return
+		}
+		cur.VATCategory = *req.VATCategory
+		rate = cur.VATCategory.Rate()
+	}
+	if req.VATInclusive != nil {
+		cur.VATInclusive = *req.VATInclusive
+	}
+
+	if cur.Date == "" || cur.ItemID == "" || cur.Quantity <= 0 || cur.UnitPrice <= 0 {
+		httpx.JSON(w, 400, map[string]string{"error": "missing/invalid fields"})
+		return
+	}
+
+	if _, err := time.Parse("2006-01-02", cur.Date); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "date must be YYYY-MM-DD"})
+		return
+	}
+	if !periodOpen(w, tx, cur.Date) {
+		return
+	}
+
+	n, err := ledger.Normalize(h.DB, ledger.Expense{ItemID: cur.ItemID, Quantity: cur.Quantity, Unit: cur.Unit, UnitPrice: cur.UnitPrice})
+	if msg, ok := unitError(err); ok {
+		httpx.JSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	net, tax, total := vat.Split(cur.UnitPrice.Mul(cur.Quantity), rate, cur.VATInclusive)
+
+	change := audit.Track(tx, "expenses", "id = ?", id)
+	_, err = tx.Exec(`
+		UPDATE expenses
+		SET purchase_date = ?, item_id = ?, quantity = ?, unit_price_fils = ?, total_price_fils = ?,
+			net_fils = ?, vat_fils = ?, vat_category = ?, vat_rate_bp = ?, vat_inclusive = ?,
+			note = ?, supplier_id = NULLIF(?, ''),
+			entered_quantity = ?, entered_unit = ?, entered_unit_price_fils = ?
+		WHERE id = ?
+	`, cur.Date, cur.ItemID, n.Quantity, n.UnitPrice, total,
+		net, tax, cur.VATCategory, rate, cur.VATInclusive,
+		cur.Note, cur.SupplierID,
+		n.EnteredQuantity, n.EnteredUnit, n.EnteredUnitPrice, id)
+	if closedMonth(w, err) {
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Update) {
+		return
+	}
+	h.Alerts.ForExpense(cur.Date, cur.ItemID)
+	httpx.JSON(w, 200, map[string]any{"id": id, "total": total, "net": net, "vat": tax})
+}
+
+// DeleteExpense removes an expense with its attachments, and the stored
+// files no other expense shares.
+func (h ExpensesHandler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
+	_ = auth.UserIDFromContext(r)
+	id := r.PathValue("id")
 
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var date string
+	err = tx.QueryRow(`SELECT substr(purchase_date, 1, 10) FROM expenses WHERE id = ?`, id).Scan(&date)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "expense not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if !periodOpen(w, tx, date) {
+		return
+	}
+
+	var sums []string
+	rows, err := tx.Query(`SELECT sha256 FROM attachments WHERE expense_id = ?`, id)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			rows.Close()
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		sums = append(sums, s)
+	}
+	rows.Close()
+
+	change := audit.Track(tx, "expenses", "id = ?", id)
+	res, err := tx.Exec(`DELETE FROM expenses WHERE id = ?`, id)
+	if closedMonth(w, err) {
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "expense not found"})
+		return
+	}
+	if !commitAudited(w, r, tx, change, audit.Delete) {
+		return
+	}
+	h.releaseBlobs(sums...)
+
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
 
 type setBudgetReq struct {
-	Month     string  `json:"month"`     // YYYY-MM
-	MaxBudget float64 `json:"maxBudget"` // BD
+	Month      string     `json:"month"`      // YYYY-MM
+	MaxBudget  money.Fils `json:"maxBudget"`  // BD, sent as 1.235
+	CategoryID string     `json:"categoryId"` // optional; sets that category's cap instead
 }
 
+// SetBudget sets the overall budget for a month or, with categoryId, the cap
+// for one category in that month. created_by stays the user who first set
+// it; later changes are in the audit log.
 func (h ExpensesHandler) SetBudget(w http.ResponseWriter, r *http.Request) {
 	userID := auth.UserIDFromContext(r)
 
 	var req setBudgetReq
 	if err := httpx.DecodeJSON(r, &req); err != nil {
-		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		httpx.JSON(w, 400, map[string]string{"error": decodeError(err)})
 		return
 	}
 	if req.Month == "" || req.MaxBudget <= 0 {
@@ -173,16 +601,93 @@ func (h ExpensesHandler) SetBudget(w http.ResponseWriter, r *http.Request) {
 
 	monthDate := req.Month + "-01"
 
-	_, err := h.DB.Exec(`
-		INSERT INTO monthly_budgets (id, month, max_budget, created_by)
-		VALUES (?, ?, ?, ?)
-		ON CONFLICT(month) DO UPDATE SET max_budget=excluded.max_budget, created_by=excluded.created_by
-	`, uuid.NewString(), monthDate, round2(req.MaxBudget), userID)
+	if req.CategoryID != "" {
+		var n int
+		if err := h.DB.QueryRow(`SELECT COUNT(1) FROM categories WHERE id = ?`, req.CategoryID).Scan(&n); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		if n == 0 {
+			httpx.JSON(w, 400, map[string]string{"error": "unknown categoryId"})
+			return
+		}
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var change *audit.Change
+	if req.CategoryID != "" {
+		change = audit.Track(tx, "category_budgets", "month = ? AND category_id = ?", monthDate, req.CategoryID)
+		_, err = tx.Exec(`
+			INSERT INTO category_budgets (id, month, category_id, max_budget_fils, created_by)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(month, category_id) DO UPDATE SET max_budget_fils=excluded.max_budget_fils
+		`, uuid.NewString(), monthDate, req.CategoryID, req.MaxBudget, userID)
+	} else {
+		change = audit.Track(tx, "monthly_budgets", "month = ?", monthDate)
+		_, err = tx.Exec(`
+			INSERT INTO monthly_budgets (id, month, max_budget_fils, created_by)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(month) DO UPDATE SET max_budget_fils=excluded.max_budget_fils
+		`, uuid.NewString(), monthDate, req.MaxBudget, userID)
+	}
 	if err != nil {
 		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
 		return
 	}
 
+	if !commitAudited(w, r, tx, change, "") {
+		return
+	}
+	h.Alerts.ForMonth(req.Month)
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+// DeleteBudget removes the overall budget of ?month=, or with ?categoryId=
+// that category's cap.
+func (h ExpensesHandler) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	_ = auth.UserIDFromContext(r)
+
+	month := r.URL.Query().Get("month")
+	if _, err := time.Parse("2006-01", month); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "month must be YYYY-MM"})
+		return
+	}
+	monthDate := month + "-01"
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var change *audit.Change
+	var res sql.Result
+	if categoryID := r.URL.Query().Get("categoryId"); categoryID != "" {
+		change = audit.Track(tx, "category_budgets", "month = ? AND category_id = ?", monthDate, categoryID)
+		res, err = tx.Exec(`DELETE FROM category_budgets WHERE month = ? AND category_id = ?`, monthDate, categoryID)
+	} else {
+		change = audit.Track(tx, "monthly_budgets", "month = ?", monthDate)
+		res, err = tx.Exec(`DELETE FROM monthly_budgets WHERE month = ?`, monthDate)
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "budget not found"})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Delete) {
+		return
+	}
 	httpx.JSON(w, 200, map[string]any{"ok": true})
 }
 
@@ -199,9 +704,9 @@ func (h ExpensesHandler) Summary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var total float64
+	var total money.Fils
 	if err := h.DB.QueryRow(`
-		SELECT COALESCE(SUM(total_price),0)
+		SELECT COALESCE(SUM(total_price_fils),0)
 		FROM expenses
 		WHERE substr(purchase_date,1,7)=?
 	`, month).Scan(&total); err != nil {
@@ -211,22 +716,28 @@ func (h ExpensesHandler) Summary(w http.ResponseWriter, r *http.Request) {
 
 	monthDate := month + "-01"
 
-	var budget sql.NullFloat64
-	if err := h.DB.QueryRow(`SELECT max_budget FROM monthly_budgets WHERE month=?`, monthDate).Scan(&budget); err != nil && err != sql.ErrNoRows {
+	var budget *money.Fils
+	if err := h.DB.QueryRow(`SELECT max_budget_fils FROM monthly_budgets WHERE month=?`, monthDate).Scan(&budget); err != nil && err != sql.ErrNoRows {
 		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
 		return
 	}
 
 	// ✅ include categoryId so frontend can navigate
+	// Categories with a cap this month are listed even before any spending.
 	rows, err := h.DB.Query(`
-		SELECT c.id, c.name, COALESCE(SUM(e.total_price),0) as cat_total
-		FROM expenses e
-		JOIN items i ON i.id = e.item_id
-		JOIN categories c ON c.id = i.category_id
-		WHERE substr(e.purchase_date,1,7) = ?
-		GROUP BY c.id, c.name
-		ORDER BY cat_total DESC
-	`, month)
+		SELECT c.id, c.name, COALESCE(sp.total, 0) as cat_total, cb.max_budget_fils
+		FROM categories c
+		LEFT JOIN (
+			SELECT i.category_id, SUM(e.total_price_fils) AS total
+			FROM expenses e
+			JOIN items i ON i.id = e.item_id
+			WHERE substr(e.purchase_date,1,7) = ?
+			GROUP BY i.category_id
+		) sp ON sp.category_id = c.id
+		LEFT JOIN category_budgets cb ON cb.category_id = c.id AND cb.month = ?
+		WHERE sp.total IS NOT NULL OR cb.id IS NOT NULL
+		ORDER BY cat_total DESC, c.name
+	`, month, monthDate)
 	if err != nil {
 		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
 		return
@@ -234,18 +745,26 @@ func (h ExpensesHandler) Summary(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	type Cat struct {
-		CategoryID string  `json:"categoryId"`
-		Category   string  `json:"category"`
-		Total      float64 `json:"total"`
+		CategoryID string      `json:"categoryId"`
+		Category   string      `json:"category"`
+		Total      money.Fils  `json:"total"`
+		Budget     *money.Fils `json:"budget"`
+		Remaining  *money.Fils `json:"remaining"` // negative once over budget
+		OverBudget bool        `json:"overBudget"`
 	}
 
 	var cats []Cat
 	for rows.Next() {
 		var c Cat
-		if err := rows.Scan(&c.CategoryID, &c.Category, &c.Total); err != nil {
+		if err := rows.Scan(&c.CategoryID, &c.Category, &c.Total, &c.Budget); err != nil {
 			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
 			return
 		}
+		if c.Budget != nil {
+			rem := *c.Budget - c.Total
+			c.Remaining = &rem
+			c.OverBudget = c.Total > *c.Budget
+		}
 		cats = append(cats, c)
 	}
 
@@ -253,20 +772,91 @@ func (h ExpensesHandler) Summary(w http.ResponseWriter, r *http.Request) {
 		cats = []Cat{}
 	}
 
+	// Expenses without a supplier are grouped under a null supplierId.
+	srows, err := h.DB.Query(`
+		SELECT s.id, COALESCE(s.name, ''), COALESCE(SUM(e.total_price_fils),0) as sup_total
+		FROM expenses e
+		LEFT JOIN suppliers s ON s.id = e.supplier_id
+		WHERE substr(e.purchase_date,1,7) = ?
+		GROUP BY s.id
+		ORDER BY sup_total DESC
+	`, month)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer srows.Close()
+
+	type Sup struct {
+		SupplierID *string    `json:"supplierId"`
+		Supplier   string     `json:"supplier"`
+		Total      money.Fils `json:"total"`
+	}
+
+	sups := []Sup{}
+	for srows.Next() {
+		var s Sup
+		if err := srows.Scan(&s.SupplierID, &s.Supplier, &s.Total); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		sups = append(sups, s)
+	}
+
 	resp := map[string]any{
-		"month": month,
-		"total": round2(total),
-		"budget": func() any {
-			if budget.Valid {
-				return round2(budget.Float64)
-			}
-			return nil
-		}(),
+		"month":  month,
+		"total":  total,
+		"budget": budget,
 		"overBudget": func() bool {
-			return budget.Valid && total > budget.Float64
+			return budget != nil && total > *budget
 		}(),
 		"byCategory": cats,
+		"bySupplier": sups,
 	}
 
 	httpx.JSON(w, 200, resp)
 }
+
+// periodOpen writes a 409 and returns false when any of dates falls in a
+// closed month. Writes pass their transaction, so the month cannot close
+// between the check and the change.
+func periodOpen(w http.ResponseWriter, q periods.Querier, dates ...string) bool {
+	err := periods.CheckOpen(q, dates...)
+	if closedMonth(w, err) {
+		return false
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// closedMonth writes a 409 and returns true when err refuses a write to a
+// closed month, from periods.CheckOpen or the closed-month triggers.
+func closedMonth(w http.ResponseWriter, err error) bool {
+	var closed *periods.ClosedError
+	if !errors.As(err, &closed) && !periods.IsViolation(err) {
+		return false
+	}
+	httpx.JSON(w, 409, map[string]string{"error": err.Error()})
+	return true
+}
+
+// unitError returns the client message for a failed unit conversion.
+func unitError(err error) (string, bool) {
+	var incompatible *units.IncompatibleError
+	switch {
+	case errors.As(err, &incompatible), errors.Is(err, units.ErrUnknownUnit), errors.Is(err, units.ErrPackCycle):
+		return err.Error(), true
+	case errors.Is(err, units.ErrUnknownItem):
+		return "unknown itemId", true
+	}
+	return "", false
+}
+
+func (h ExpensesHandler) supplierExists(id string) (bool, error) {
+	var n int
+	err := h.DB.QueryRow(`SELECT COUNT(1) FROM suppliers WHERE id = ?`, id).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/money"
+	"almanarteen-backend/internal/xlsx"
+)
+
+// exportColumns heads the expense rows of both export formats, in the order
+// exportRow fills them.
+var exportColumns = []string{
+	"Date", "Category", "Item", "Unit", "Quantity", "Unit price (BD)",
+	"Net (BD)", "VAT (BD)", "Total (BD)", "VAT category", "VAT rate (%)", "VAT inclusive",
+	"Supplier", "Note", "Attachments", "Created by",
+}
+
+// exportTotals accumulates the totals row while rows stream out.
+type exportTotals struct {
+	Count           int
+	Net, VAT, Total money.Fils
+}
+
+func (t *exportTotals) add(x expenseRow) {
+	t.Count++
+	t.Net += x.Net
+	t.VAT += x.VAT
+	t.Total += x.Total
+}
+
+// sheetWriter is the part of the CSV and XLSX writers the export needs.
+type sheetWriter interface {
+	header() error
+	expense(x expenseRow) error
+	totals(t exportTotals) error
+	categories(rows []exportCategory) error
+	close() error
+}
+
+type exportCategory struct {
+	Category        string
+	Count           int
+	Net, VAT, Total money.Fils
+}
+
+// ExportExpenses streams the expenses matching the ListExpenses filters as
+// format=csv (default) or format=xlsx, oldest first unless sort/order say
+// otherwise, followed by a totals row. The XLSX file has a second sheet with
+// the per-category breakdown.
+func (h ExpensesHandler) ExportExpenses(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		httpx.JSON(w, 400, map[string]string{"error": "format must be csv or xlsx"})
+		return
+	}
+
+	f, err := parseExpenseFilter(q)
+	if err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+	if q.Get("order") == "" {
+		q.Set("order", "asc")
+	}
+	q.Del("limit")
+	q.Del("cursor")
+	page, err := parseExpensePage(q)
+	if err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": err.Error()})
+		return
+	}
+
+	where, args := f.where()
+
+	// The breakdown is small; fetch it before streaming so a failure can
+	// still be reported as an error response.
+	cats, err := h.exportCategories(where, args)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	rows, err := h.DB.Query(expenseRowSelect+` WHERE `+where+page.orderBy(), args...)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	name := "expenses"
+	if f.From != "" {
+		name += "-from-" + f.From
+	}
+	if f.To != "" {
+		name += "-to-" + f.To
+	}
+
+	var out sheetWriter
+	if format == "xlsx" {
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		out = newXLSXExport(w)
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		out = newCSVExport(w)
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+
+	// From here on the response has started; errors can only be logged and
+	// the download left truncated.
+	if err := out.header(); err != nil {
+		log.Printf("export: %v", err)
+		return
+	}
+	var t exportTotals
+	for rows.Next() {
+		var x expenseRow
+		if err := scanExpenseRow(rows, &x); err != nil {
+			log.Printf("export: %v", err)
+			return
+		}
+		if err := out.expense(x); err != nil {
+			log.Printf("export: %v", err)
+			return
+		}
+		t.add(x)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("export: %v", err)
+		return
+	}
+
+	if err := out.totals(t); err != nil {
+		log.Printf("export: %v", err)
+		return
+	}
+	if err := out.categories(cats); err != nil {
+		log.Printf("export: %v", err)
+		return
+	}
+	if err := out.close(); err != nil {
+		log.Printf("export: %v", err)
+	}
+}
+
+func (h ExpensesHandler) exportCategories(where string, args []any) ([]exportCategory, error) {
+	rows, err := h.DB.Query(`
+		SELECT c.name, COUNT(1), COALESCE(SUM(e.net_fils),0), COALESCE(SUM(e.vat_fils),0), COALESCE(SUM(e.total_price_fils),0) AS cat_total
+		`+expenseRowFrom+`
+		WHERE `+where+`
+		GROUP BY c.id, c.name
+		ORDER BY cat_total DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []exportCategory
+	for rows.Next() {
+		var c exportCategory
+		if err := rows.Scan(&c.Category, &c.Count, &c.Net, &c.VAT, &c.Total); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// csvExport writes one table; the category breakdown is left to the XLSX
+// format since CSV has no second sheet.
+type csvExport struct {
+	w     *csv.Writer
+	flush http.Flusher
+	n     int
+}
+
+func newCSVExport(w http.ResponseWriter) *csvExport {
+	e := &csvExport{w: csv.NewWriter(w)}
+	e.flush, _ = w.(http.Flusher)
+	return e
+}
+
+func (e *csvExport) header() error {
+	return e.w.Write(exportColumns)
+}
+
+func (e *csvExport) expense(x expenseRow) error {
+	supplier := ""
+	if x.Supplier != nil {
+		supplier = *x.Supplier
+	}
+	e.n++
+	if e.n%500 == 0 {
+		e.w.Flush()
+		if e.flush != nil {
+			e.flush.Flush()
+		}
+	}
+	return e.w.Write([]string{
+		exportDate(x.Date), csvText(x.Category), csvText(x.Item), csvText(x.Unit),
+		strconv.FormatFloat(x.Quantity, 'f', -1, 64), x.UnitPrice.String(),
+		x.Net.String(), x.VAT.String(), x.Total.String(),
+		string(x.VATCategory), strconv.FormatFloat(x.VATRate, 'f', -1, 64), strconv.FormatBool(x.VATInclusive),
+		csvText(supplier), csvText(x.Note), strconv.Itoa(x.Attachments), csvText(x.CreatedBy),
+	})
+}
+
+// csvText keeps spreadsheets from running user text as a formula: a cell
+// starting with one of the formula characters is prefixed with a quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func (e *csvExport) totals(t exportTotals) error {
+	return e.w.Write([]string{
+		"Total", strconv.Itoa(t.Count) + " expenses", "", "", "", "",
+		t.Net.String(), t.VAT.String(), t.Total.String(),
+	})
+}
+
+func (e *csvExport) categories([]exportCategory) error { return nil }
+
+func (e *csvExport) close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type xlsxExport struct {
+	w *xlsx.Writer
+}
+
+func newXLSXExport(w http.ResponseWriter) *xlsxExport {
+	return &xlsxExport{w: xlsx.NewWriter(w)}
+}
+
+func (e *xlsxExport) header() error {
+	if err := e.w.NewSheet("Expenses"); err != nil {
+		return err
+	}
+	head := make([]any, len(exportColumns))
+	for i, c := range exportColumns {
+		head[i] = xlsx.Bold(c)
+	}
+	return e.w.WriteRow(head...)
+}
+
+func (e *xlsxExport) expense(x expenseRow) error {
+	var date any = exportDate(x.Date)
+	if d, err := time.Parse("2006-01-02", exportDate(x.Date)); err == nil {
+		date = d
+	}
+	var supplier any
+	if x.Supplier != nil {
+		supplier = *x.Supplier
+	}
+	return e.w.WriteRow(
+		date, x.Category, x.Item, x.Unit,
+		x.Quantity, amount(x.UnitPrice),
+		amount(x.Net), amount(x.VAT), amount(x.Total),
+		string(x.VATCategory), x.VATRate, strconv.FormatBool(x.VATInclusive),
+		supplier, x.Note, x.Attachments, x.CreatedBy,
+	)
+}
+
+func (e *xlsxExport) totals(t exportTotals) error {
+	return e.w.WriteRow(
+		xlsx.Bold("Total"), xlsx.Bold(strconv.Itoa(t.Count)+" expenses"), nil, nil, nil, nil,
+		amount(t.Net), amount(t.VAT), amount(t.Total),
+	)
+}
+
+func (e *xlsxExport) categories(rows []exportCategory) error {
+	if err := e.w.NewSheet("By category"); err != nil {
+		return err
+	}
+	if err := e.w.WriteRow(xlsx.Bold("Category"), xlsx.Bold("Expenses"), xlsx.Bold("Net (BD)"), xlsx.Bold("VAT (BD)"), xlsx.Bold("Total (BD)")); err != nil {
+		return err
+	}
+	var t exportCategory
+	for _, c := range rows {
+		if err := e.w.WriteRow(c.Category, c.Count, amount(c.Net), amount(c.VAT), amount(c.Total)); err != nil {
+			return err
+		}
+		t.Count += c.Count
+		t.Net += c.Net
+		t.VAT += c.VAT
+		t.Total += c.Total
+	}
+	return e.w.WriteRow(xlsx.Bold("Total"), t.Count, amount(t.Net), amount(t.VAT), amount(t.Total))
+}
+
+func (e *xlsxExport) close() error {
+	return e.w.Close()
+}
+
+func amount(f money.Fils) xlsx.Amount {
+	return xlsx.Amount(float64(f) / money.FilsPerDinar)
+}
+
+// exportDate trims the time the SQLite driver appends to DATE columns.
+func exportDate(s string) string {
+	if len(s) > 10 {
+		return s[:10]
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/importer"
+)
+
+// MaxImportSize caps an uploaded CSV file.
+const MaxImportSize = 10 << 20 // 10 MiB
+
+// ImportExpenses loads expenses from a CSV file sent as the multipart "file"
+// field or as the raw request body. Query parameters:
+//
+//	dryRun=1         validate and report without saving (recommended first)
+//	createMissing=1  create unknown categories/items (needs catalog:write)
+//	map.<field>=Col  use column Col for field (date, category, item, unit,
+//	                 quantity, unitPrice, note) instead of header detection
+//
+// Nothing is saved unless every row is valid.
+func (h ExpensesHandler) ImportExpenses(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserIDFromContext(r)
+	q := r.URL.Query()
+
+	opts := importer.Options{
+		CreatedBy:     userID,
+		Actor:         audit.ActorFrom(r),
+		DryRun:        queryFlag(q.Get("dryRun")),
+		CreateMissing: queryFlag(q.Get("createMissing")),
+		Columns:       map[string]string{},
+	}
+	for k, v := range q {
+		if field, ok := strings.CutPrefix(k, "map."); ok && len(v) > 0 {
+			opts.Columns[field] = v[0]
+		}
+	}
+	if opts.CreateMissing && !auth.Can(r, auth.PermCatalogWrite) {
+		httpx.JSON(w, 403, map[string]string{"error": "creating categories and items needs catalog:write"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportSize)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			httpx.JSON(w, 400, map[string]string{"error": importBodyError(err)})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	res, err := importer.Import(h.DB, body, opts)
+	if err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": importBodyError(err)})
+		return
+	}
+
+	switch {
+	case res.Committed:
+		for _, m := range res.Months {
+			h.Alerts.ForMonth(m)
+		}
+		httpx.JSON(w, 201, res)
+	case len(res.Errors) > 0 && !opts.DryRun:
+		httpx.JSON(w, 422, res)
+	default:
+		httpx.JSON(w, 200, res)
+	}
+}
+
+func importBodyError(err error) string {
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		return "file is larger than 10 MB"
+	}
+	if errors.Is(err, http.ErrMissingFile) {
+		return `multipart field "file" is required`
+	}
+	return err.Error()
+}
+
+func queryFlag(v string) bool {
+	return v == "1" || v == "true"
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/db"
+	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/recurring"
+
+	"github.com/google/uuid"
+)
+
+type PeriodsHandler struct{ DB *sql.DB }
+
+type closedPeriod struct {
+	ID           string     `json:"id"`
+	Month        string     `json:"month"` // YYYY-MM
+	ClosedAt     time.Time  `json:"closedAt"`
+	ClosedBy     string     `json:"closedBy"`
+	ReopenedAt   *time.Time `json:"reopenedAt"`
+	ReopenedBy   *string    `json:"reopenedBy"`
+	ReopenReason *string    `json:"reopenReason"`
+}
+
+// ListPeriods returns the close history, newest month first. A month is
+// closed while its latest row has no reopenedAt.
+func (h PeriodsHandler) ListPeriods(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`
+		SELECT p.id, substr(p.month, 1, 7), p.closed_at, cu.name, p.reopened_at, ru.name, p.reopen_reason
+		FROM closed_periods p
+		JOIN users cu ON cu.id = p.closed_by
+		LEFT JOIN users ru ON ru.id = p.reopened_by
+		ORDER BY p.month DESC, p.closed_at DESC
+	`)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	out := []closedPeriod{}
+	for rows.Next() {
+		var p closedPeriod
+		if err := rows.Scan(&p.ID, &p.Month, &p.ClosedAt, &p.ClosedBy, &p.ReopenedAt, &p.ReopenedBy, &p.ReopenReason); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		out = append(out, p)
+	}
+	httpx.JSON(w, 200, out)
+}
+
+// ClosePeriod locks the month in the path (YYYY-MM). Only months that have
+// ended in the business's time zone can be closed.
+func (h PeriodsHandler) ClosePeriod(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+
+	month := r.PathValue("month")
+	m, err := time.Parse("2006-01", month)
+	if err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "month must be YYYY-MM"})
+		return
+	}
+	if m.AddDate(0, 1, 0).After(recurring.Today()) {
+		httpx.JSON(w, 400, map[string]string{"error": "only past months can be closed"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	id := uuid.NewString()
+	_, err = tx.Exec(`INSERT INTO closed_periods (id, month, closed_at, closed_by) VALUES (?, ?, ?, ?)`,
+		id, month+"-01", time.Now().UTC(), uid)
+	if db.IsUniqueViolation(err) {
+		httpx.JSON(w, 409, map[string]string{"error": month + " is already closed"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if !commitAudited(w, r, tx, audit.Inserted("closed_periods", "id = ?", id), "close") {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+type reopenPeriodReq struct {
+	Reason string `json:"reason"`
+}
+
+// ReopenPeriod unlocks a closed month. The reason is required and kept with
+// the close record.
+func (h PeriodsHandler) ReopenPeriod(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+
+	var req reopenPeriodReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		httpx.JSON(w, 400, map[string]string{"error": "reason is required"})
+		return
+	}
+
+	month := r.PathValue("month")
+	if _, err := time.Parse("2006-01", month); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "month must be YYYY-MM"})
+		return
+	}
+
+	var id string
+	err := h.DB.QueryRow(`SELECT id FROM closed_periods WHERE month = ? AND reopened_at IS NULL`, month+"-01").Scan(&id)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 409, map[string]string{"error": month + " is not closed"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "closed_periods", "id = ?", id)
+	res, err := tx.Exec(`
+		UPDATE closed_periods SET reopened_at = ?, reopened_by = ?, reopen_reason = ?
+		WHERE id = ? AND reopened_at IS NULL
+	`, time.Now().UTC(), uid, req.Reason, id)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 409, map[string]string{"error": month + " is not closed"})
+		return
+	}
+	if !commitAudited(w, r, tx, change, "reopen") {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
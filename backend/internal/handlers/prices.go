@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"time"
+
+	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/money"
+	"almanarteen-backend/internal/recurring"
+)
+
+// priceStats summarises the unit prices paid in a set of purchases. Avg is
+// weighted by quantity, so one small top-up does not skew it.
+type priceStats struct {
+	Min      money.Fils `json:"min"`
+	Avg      money.Fils `json:"avg"`
+	Max      money.Fils `json:"max"`
+	Last     money.Fils `json:"last"`
+	LastDate string     `json:"lastDate"`
+	Count    int        `json:"count"`
+
+	weighted, qty float64
+}
+
+func (s *priceStats) add(date string, price money.Fils, qty float64) {
+	if s.Count == 0 || price < s.Min {
+		s.Min = price
+	}
+	if price > s.Max {
+		s.Max = price
+	}
+	// Purchases arrive oldest first.
+	s.Last = price
+	s.LastDate = date
+	s.Count++
+	s.weighted += float64(price) * qty
+	s.qty += qty
+	if s.qty > 0 {
+		s.Avg = money.Fils(s.weighted/s.qty + 0.5)
+	}
+}
+
+type pricePeriod struct {
+	Period string `json:"period"` // YYYY-MM, or the Monday of the week
+	priceStats
+}
+
+// priceSeries is the price history of all purchases or of one supplier's.
+type priceSeries struct {
+	SupplierID *string `json:"supplierId,omitempty"`
+	Supplier   *string `json:"supplier,omitempty"`
+	priceStats
+	Periods []pricePeriod `json:"periods"`
+
+	byPeriod map[string]int
+}
+
+func (s *priceSeries) add(period, date string, price money.Fils, qty float64) {
+	s.priceStats.add(date, price, qty)
+	if s.byPeriod == nil {
+		s.byPeriod = map[string]int{}
+	}
+	i, ok := s.byPeriod[period]
+	if !ok {
+		i = len(s.Periods)
+		s.byPeriod[period] = i
+		s.Periods = append(s.Periods, pricePeriod{Period: period})
+	}
+	s.Periods[i].add(date, price, qty)
+}
+
+// PriceHistory returns the unit prices paid for an item over time, overall
+// and per supplier. ?from= and ?to= (YYYY-MM-DD) bound the purchases,
+// defaulting to the last year; ?interval=month (default) or week sets the
+// period size.
+func (h ReportsHandler) PriceHistory(w http.ResponseWriter, r *http.Request) {
+	itemID := r.PathValue("id")
+	q := r.URL.Query()
+
+	var item, unit string
+	err := h.DB.QueryRow(`SELECT name, unit FROM items WHERE id = ?`, itemID).Scan(&item, &unit)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "item not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	now := recurring.Today()
+	from, to := now.AddDate(-1, 0, 0).Format("2006-01-02"), now.Format("2006-01-02")
+	if v := q.Get("from"); v != "" {
+		from = v
+	}
+	if v := q.Get("to"); v != "" {
+		to = v
+	}
+	_, err1 := time.Parse("2006-01-02", from)
+	_, err2 := time.Parse("2006-01-02", to)
+	if err1 != nil || err2 != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "from and to must be YYYY-MM-DD"})
+		return
+	}
+
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+	if interval != "month" && interval != "week" {
+		httpx.JSON(w, 400, map[string]string{"error": "interval must be month or week"})
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT substr(e.purchase_date, 1, 10) AS d, e.unit_price_fils, e.quantity, s.id, s.name
+		FROM expenses e
+		LEFT JOIN suppliers s ON s.id = e.supplier_id
+		WHERE e.item_id = ? AND substr(e.purchase_date, 1, 10) BETWEEN ? AND ?
+		ORDER BY d, e.created_at
+	`, itemID, from, to)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	overall := priceSeries{Periods: []pricePeriod{}}
+	suppliers := map[string]*priceSeries{}
+	for rows.Next() {
+		var date string
+		var price money.Fils
+		var qty float64
+		var supplierID, supplier *string
+		if err := rows.Scan(&date, &price, &qty, &supplierID, &supplier); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+
+		period := date[:7]
+		if interval == "week" {
+			d, _ := time.Parse("2006-01-02", date)
+			period = d.AddDate(0, 0, -(int(d.Weekday())+6)%7).Format("2006-01-02")
+		}
+
+		overall.add(period, date, price, qty)
+		if supplierID != nil {
+			s, ok := suppliers[*supplierID]
+			if !ok {
+				s = &priceSeries{SupplierID: supplierID, Supplier: supplier}
+				suppliers[*supplierID] = s
+			}
+			s.add(period, date, price, qty)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	bySupplier := make([]priceSeries, 0, len(suppliers))
+	for _, s := range suppliers {
+		bySupplier = append(bySupplier, *s)
+	}
+	sort.Slice(bySupplier, func(i, j int) bool { return *bySupplier[i].Supplier < *bySupplier[j].Supplier })
+
+	httpx.JSON(w, 200, map[string]any{
+		"itemId":     itemID,
+		"item":       item,
+		"unit":       unit,
+		"from":       from,
+		"to":         to,
+		"interval":   interval,
+		"overall":    overall,
+		"bySupplier": bySupplier,
+	})
+}
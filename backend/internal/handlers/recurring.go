@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/ledger"
+	"almanarteen-backend/internal/money"
+	"almanarteen-backend/internal/recurring"
+	"almanarteen-backend/internal/vat"
+
+	"github.com/google/uuid"
+)
+
+type RecurringHandler struct {
+	DB        *sql.DB
+	Scheduler *recurring.Scheduler
+}
+
+// recurringReq creates or edits a template. Nil fields keep their current
+// value on PATCH. weekday defaults to the start date's weekday and
+// dayOfMonth to its day.
+type recurringReq struct {
+	ItemID       *string       `json:"itemId"`
+	Quantity     *float64      `json:"quantity"`
+	Unit         *string       `json:"unit"`
+	UnitPrice    *money.Fils   `json:"unitPrice"`
+	Note         *string       `json:"note"`
+	SupplierID   *string       `json:"supplierId"` // empty string unlinks
+	VATCategory  *vat.Category `json:"vatCategory"`
+	VATInclusive *bool         `json:"vatInclusive"`
+	Frequency    *string       `json:"frequency"` // weekly or monthly
+	Weekday      *int          `json:"weekday"`   // 0 = Sunday
+	DayOfMonth   *int          `json:"dayOfMonth"`
+	StartDate    *string       `json:"startDate"` // YYYY-MM-DD, default today
+	EndDate      *string       `json:"endDate"`   // empty string for no end
+
+	// ConfirmBackfill allows recording more than recurring.BackfillLimit
+	// past occurrences at once.
+	ConfirmBackfill bool `json:"confirmBackfill"`
+}
+
+// apply copies the set fields of req onto t and validates the result.
+func (h RecurringHandler) apply(t *recurring.Template, req recurringReq) (int, string) {
+	if req.ItemID != nil {
+		t.ItemID = *req.ItemID
+	}
+	if req.Quantity != nil {
+		t.Quantity = *req.Quantity
+	}
+	if req.Unit != nil {
+		t.Unit = strings.TrimSpace(*req.Unit)
+	}
+	if req.UnitPrice != nil {
+		t.UnitPrice = *req.UnitPrice
+	}
+	if req.Note != nil {
+		t.Note = *req.Note
+	}
+	if req.SupplierID != nil {
+		t.SupplierID = nil
+		if *req.SupplierID != "" {
+			t.SupplierID = req.SupplierID
+		}
+	}
+	if req.VATCategory != nil {
+		t.VATCategory = *req.VATCategory
+	}
+	if req.VATInclusive != nil {
+		t.VATInclusive = *req.VATInclusive
+	}
+	if req.StartDate != nil {
+		t.StartDate = *req.StartDate
+	}
+	if req.EndDate != nil {
+		t.EndDate = nil
+		if *req.EndDate != "" {
+			t.EndDate = req.EndDate
+		}
+	}
+	if req.Frequency != nil {
+		t.Frequency = *req.Frequency
+	}
+	if req.Weekday != nil {
+		t.Weekday = req.Weekday
+	}
+	if req.DayOfMonth != nil {
+		t.DayOfMonth = req.DayOfMonth
+	}
+
+	start, err := time.Parse("2006-01-02", t.StartDate)
+	if err != nil {
+		return 400, "startDate must be YYYY-MM-DD"
+	}
+	// Only the field the frequency uses is kept.
+	switch t.Frequency {
+	case recurring.Weekly:
+		if t.Weekday == nil {
+			wd := int(start.Weekday())
+			t.Weekday = &wd
+		}
+		t.DayOfMonth = nil
+	case recurring.Monthly:
+		if t.DayOfMonth == nil {
+			d := start.Day()
+			t.DayOfMonth = &d
+		}
+		t.Weekday = nil
+	}
+	if _, err := t.Schedule(); err != nil {
+		return 400, err.Error()
+	}
+
+	if t.ItemID == "" || t.Quantity <= 0 || t.UnitPrice <= 0 {
+		return 400, "itemId, a positive quantity and unitPrice are required"
+	}
+	if t.VATCategory == "" {
+		t.VATCategory = vat.Exempt
+	}
+	if !t.VATCategory.Valid() {
+		return 400, vat.ErrInvalidCategory.Error()
+	}
+	_, err = ledger.Normalize(h.DB, ledger.Expense{ItemID: t.ItemID, Quantity: t.Quantity, Unit: t.Unit, UnitPrice: t.UnitPrice})
+	if msg, ok := unitError(err); ok {
+		return 400, msg
+	}
+	if err != nil {
+		return 500, err.Error()
+	}
+	if t.SupplierID != nil {
+		var n int
+		if err := h.DB.QueryRow(`SELECT COUNT(1) FROM suppliers WHERE id = ?`, *t.SupplierID).Scan(&n); err != nil {
+			return 500, err.Error()
+		}
+		if n == 0 {
+			return 400, "unknown supplierId"
+		}
+	}
+	return 0, ""
+}
+
+func (h RecurringHandler) ListRecurring(w http.ResponseWriter, r *http.Request) {
+	out, err := recurring.List(h.DB)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, 200, out)
+}
+
+func (h RecurringHandler) GetRecurring(w http.ResponseWriter, r *http.Request) {
+	t, err := recurring.Get(h.DB, r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "recurring expense not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, 200, t)
+}
+
+// CreateRecurring saves a template and records the occurrences already due,
+// so a start date in the past backfills them. More than
+// recurring.BackfillLimit of them need confirmBackfill.
+func (h RecurringHandler) CreateRecurring(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserIDFromContext(r)
+
+	var req recurringReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": decodeError(err)})
+		return
+	}
+
+	t := recurring.Template{
+		ID:        uuid.NewString(),
+		StartDate: recurring.Today().Format("2006-01-02"),
+		CreatedBy: userID,
+	}
+	if status, msg := h.apply(&t, req); status != 0 {
+		httpx.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !checkBackfill(w, t, req.ConfirmBackfill) {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "recurring_expenses", "id = ?", t.ID)
+	_, err = tx.Exec(`
+		INSERT INTO recurring_expenses (id, item_id, quantity, unit, unit_price_fils, note, supplier_id,
+			vat_category, vat_inclusive, frequency, weekday, day_of_month, start_date, end_date, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.ID, t.ItemID, t.Quantity, t.Unit, t.UnitPrice, t.Note, t.SupplierID,
+		t.VATCategory, t.VATInclusive, t.Frequency, t.Weekday, t.DayOfMonth, t.StartDate, t.EndDate, t.CreatedBy)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Create) {
+		return
+	}
+	h.respond(w, 201, t.ID)
+}
+
+// UpdateRecurring edits a template. Changes apply to occurrences not yet
+// recorded; expenses already created are left as they are.
+func (h RecurringHandler) UpdateRecurring(w http.ResponseWriter, r *http.Request) {
+	var req recurringReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": decodeError(err)})
+		return
+	}
+
+	t, err := recurring.Get(h.DB, r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "recurring expense not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if status, msg := h.apply(&t, req); status != 0 {
+		httpx.JSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	if !checkBackfill(w, t, req.ConfirmBackfill) {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "recurring_expenses", "id = ?", t.ID)
+	_, err = tx.Exec(`
+		UPDATE recurring_expenses
+		SET item_id = ?, quantity = ?, unit = ?, unit_price_fils = ?, note = ?, supplier_id = ?,
+			vat_category = ?, vat_inclusive = ?, frequency = ?, weekday = ?, day_of_month = ?,
+			start_date = ?, end_date = ?, updated_at = ?
+		WHERE id = ?
+	`, t.ItemID, t.Quantity, t.Unit, t.UnitPrice, t.Note, t.SupplierID,
+		t.VATCategory, t.VATInclusive, t.Frequency, t.Weekday, t.DayOfMonth,
+		t.StartDate, t.EndDate, time.Now().UTC(), t.ID)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Update) {
+		return
+	}
+	h.respond(w, 200, t.ID)
+}
+
+// PauseRecurring stops a template from recording expenses until resumed.
+func (h RecurringHandler) PauseRecurring(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "recurring_expenses", "id = ?", id)
+	res, err := tx.Exec(`UPDATE recurring_expenses SET paused_at = COALESCE(paused_at, ?), updated_at = ? WHERE id = ?`,
+		time.Now().UTC(), time.Now().UTC(), id)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "recurring expense not found"})
+		return
+	}
+	if !commitAudited(w, r, tx, change, "pause") {
+		return
+	}
+	h.respond(w, 200, id)
+}
+
+// ResumeRecurring restarts a paused template. Occurrences that fell while it
+// was paused are skipped unless ?backfill=1; more than
+// recurring.BackfillLimit of them also need ?confirmBackfill=1.
+func (h RecurringHandler) ResumeRecurring(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	q := r.URL.Query()
+
+	query := `UPDATE recurring_expenses SET paused_at = NULL, updated_at = ? WHERE id = ?`
+	args := []any{time.Now().UTC(), id}
+	if queryFlag(q.Get("backfill")) {
+		t, err := recurring.Get(h.DB, id)
+		if err == sql.ErrNoRows {
+			httpx.JSON(w, 404, map[string]string{"error": "recurring expense not found"})
+			return
+		}
+		if err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		if !checkBackfill(w, t, queryFlag(q.Get("confirmBackfill"))) {
+			return
+		}
+	} else {
+		yesterday := recurring.Today().AddDate(0, 0, -1).Format("2006-01-02")
+		query = `
+			UPDATE recurring_expenses
+			SET done_through = CASE
+					WHEN paused_at IS NOT NULL AND COALESCE(substr(done_through, 1, 10), '') < ? THEN ?
+					ELSE done_through
+				END,
+				paused_at = NULL, updated_at = ?
+			WHERE id = ?
+		`
+		args = append([]any{yesterday, yesterday}, args...)
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "recurring_expenses", "id = ?", id)
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "recurring expense not found"})
+		return
+	}
+	if !commitAudited(w, r, tx, change, "resume") {
+		return
+	}
+	h.respond(w, 200, id)
+}
+
+// DeleteRecurring removes a template. Expenses it recorded are kept.
+func (h RecurringHandler) DeleteRecurring(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "recurring_expenses", "id = ?", id)
+	res, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = ?`, id)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "recurring expense not found"})
+		return
+	}
+	if !commitAudited(w, r, tx, change, audit.Delete) {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+// PreviewRecurring lists the next ?count= (default 5, at most 100) dates the
+// template will record an expense on, without recording anything.
+func (h RecurringHandler) PreviewRecurring(w http.ResponseWriter, r *http.Request) {
+	count := 5
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			httpx.JSON(w, 400, map[string]string{"error": "count must be between 1 and 100"})
+			return
+		}
+		count = n
+	}
+
+	t, err := recurring.Get(h.DB, r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "recurring expense not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	dates, err := t.Upcoming(count)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	amounts := ledger.Compute(ledger.Expense{Quantity: t.Quantity, UnitPrice: t.UnitPrice, VATCategory: t.VATCategory, VATInclusive: t.VATInclusive})
+
+	httpx.JSON(w, 200, map[string]any{
+		"id":     t.ID,
+		"paused": t.Paused,
+		"dates":  dates,
+		"amount": amounts,
+	})
+}
+
+// checkBackfill answers 409 and returns false when saving t would record
+// more than recurring.BackfillLimit past occurrences without confirmation.
+func checkBackfill(w http.ResponseWriter, t recurring.Template, confirmed bool) bool {
+	n, err := t.Due(recurring.Today())
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return false
+	}
+	if n > recurring.BackfillLimit && !confirmed {
+		httpx.JSON(w, 409, map[string]any{
+			"error":    strconv.Itoa(n) + " past occurrences would be recorded; resend with confirmBackfill to record them",
+			"backfill": n,
+		})
+		return false
+	}
+	return true
+}
+
+// respond records whatever the template now has due and returns it. The
+// template is saved by then, so a failure to record is only logged; the
+// scheduler catches up on its next run.
+func (h RecurringHandler) respond(w http.ResponseWriter, status int, id string) {
+	recorded, err := h.Scheduler.Materialize(id, recurring.Today())
+	if err != nil {
+		log.Printf("recurring: %s: %v", id, err)
+	}
+	t, err := recurring.Get(h.DB, id)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, status, map[string]any{"recurring": t, "recorded": recorded})
+}
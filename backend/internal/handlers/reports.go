@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/money"
+	"almanarteen-backend/internal/recurring"
+	"almanarteen-backend/internal/vat"
+)
+
+type ReportsHandler struct{ DB *sql.DB }
+
+// vatQuarter holds one quarter of the input VAT report. Only VAT on
+// standard-rated expenses is reclaimable; zero-rated and exempt purchases
+// are listed because the return asks for them separately.
+type vatQuarter struct {
+	Quarter       string     `json:"quarter"` // e.g. 2026-Q1
+	From          string     `json:"from"`
+	To            string     `json:"to"`
+	StandardNet   money.Fils `json:"standardNet"`
+	InputVAT      money.Fils `json:"inputVat"`
+	ZeroRatedNet  money.Fils `json:"zeroRatedNet"`
+	ExemptTotal   money.Fils `json:"exemptTotal"`
+	Gross         money.Fils `json:"gross"`
+	ExpenseCount  int        `json:"expenseCount"`
+	NoSupplierVAT int        `json:"noSupplierVat"` // standard-rated expenses whose supplier has no VAT number
+}
+
+func (q *vatQuarter) add(o vatQuarter) {
+	q.StandardNet += o.StandardNet
+	q.InputVAT += o.InputVAT
+	q.ZeroRatedNet += o.ZeroRatedNet
+	q.ExemptTotal += o.ExemptTotal
+	q.Gross += o.Gross
+	q.ExpenseCount += o.ExpenseCount
+	q.NoSupplierVAT += o.NoSupplierVAT
+}
+
+// VATReport totals input VAT per calendar quarter of ?year= (default: the
+// current year) for the NBR return.
+func (h ReportsHandler) VATReport(w http.ResponseWriter, r *http.Request) {
+	year := recurring.Today().Year()
+	if v := r.URL.Query().Get("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil || y < 2000 || y > 9999 {
+			httpx.JSON(w, 400, map[string]string{"error": "year must be YYYY"})
+			return
+		}
+		year = y
+	}
+
+	quarters := make([]vatQuarter, 4)
+	for i := range quarters {
+		from := time.Date(year, time.Month(3*i+1), 1, 0, 0, 0, 0, time.UTC)
+		quarters[i] = vatQuarter{
+			Quarter: fmt.Sprintf("%d-Q%d", year, i+1),
+			From:    from.Format("2006-01-02"),
+			To:      from.AddDate(0, 3, -1).Format("2006-01-02"),
+		}
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT
+			(CAST(substr(e.purchase_date, 6, 2) AS INTEGER) - 1) / 3 AS q,
+			e.vat_category,
+			COALESCE(SUM(e.net_fils), 0),
+			COALESCE(SUM(e.vat_fils), 0),
+			COALESCE(SUM(e.total_price_fils), 0),
+			COUNT(1),
+			COALESCE(SUM(CASE WHEN COALESCE(s.vat_number, '') = '' THEN 1 ELSE 0 END), 0)
+		FROM expenses e
+		LEFT JOIN suppliers s ON s.id = e.supplier_id
+		WHERE substr(e.purchase_date, 1, 4) = ?
+		GROUP BY q, e.vat_category
+	`, strconv.Itoa(year))
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var q int
+		var cat vat.Category
+		var net, tax, gross money.Fils
+		var count, noVAT int
+		if err := rows.Scan(&q, &cat, &net, &tax, &gross, &count, &noVAT); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		if q < 0 || q > 3 {
+			continue
+		}
+
+		part := vatQuarter{Gross: gross, ExpenseCount: count}
+		switch cat {
+		case vat.Standard:
+			part.StandardNet = net
+			part.InputVAT = tax
+			part.NoSupplierVAT = noVAT
+		case vat.Zero:
+			part.ZeroRatedNet = net
+		default:
+			part.ExemptTotal = gross
+		}
+		quarters[q].add(part)
+	}
+	if err := rows.Err(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	total := vatQuarter{Quarter: strconv.Itoa(year), From: quarters[0].From, To: quarters[3].To}
+	for _, q := range quarters {
+		total.add(q)
+	}
+
+	httpx.JSON(w, 200, map[string]any{
+		"year":     year,
+		"rate":     float64(vat.StandardRate) / 100,
+		"quarters": quarters,
+		"total":    total,
+	})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/httpx"
+)
+
+type sessionRow struct {
+	ID         string     `json:"id"`
+	UserAgent  string     `json:"userAgent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt *time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	Current    bool       `json:"current"`
+}
+
+// ListSessions returns the signed-in user's active sessions.
+func (h AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+	current := auth.SessionIDFromContext(r)
+
+	rows, err := h.DB.Query(`
+		SELECT id, user_agent, ip, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY COALESCE(last_seen_at, created_at) DESC
+	`, uid, time.Now().UTC())
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	out := []sessionRow{}
+	for rows.Next() {
+		var s sessionRow
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		s.Current = s.ID == current
+		out = append(out, s)
+	}
+
+	httpx.JSON(w, 200, out)
+}
+
+// RevokeSession signs out one of the user's own sessions. Session ids are
+// token hashes, so listing them does not expose usable cookies.
+func (h AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	uid := auth.UserIDFromContext(r)
+	sid := r.PathValue("id")
+
+	res, err := h.DB.Exec(`DELETE FROM sessions WHERE id = ? AND user_id = ?`, sid, uid)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "session not found"})
+		return
+	}
+	if sid == auth.SessionIDFromContext(r) {
+		auth.ClearSessionCookie(w)
+	}
+
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+// LogoutAll signs the user out on every device, this one included.
+func (h AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if err := auth.RevokeUserSessions(h.DB, auth.UserIDFromContext(r)); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	auth.ClearSessionCookie(w)
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/db"
+	"almanarteen-backend/internal/httpx"
+
+	"github.com/google/uuid"
+)
+
+type supplier struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	CRNumber     string  `json:"crNumber"`
+	VATNumber    string  `json:"vatNumber"`
+	Phone        string  `json:"phone"`
+	PaymentTerms string  `json:"paymentTerms"`
+	ArchivedAt   *string `json:"archivedAt,omitempty"`
+}
+
+const supplierSelect = `SELECT id, name, cr_number, vat_number, phone, payment_terms, archived_at FROM suppliers`
+
+func scanSupplier(s rowScanner, x *supplier) error {
+	return s.Scan(&x.ID, &x.Name, &x.CRNumber, &x.VATNumber, &x.Phone, &x.PaymentTerms, &x.ArchivedAt)
+}
+
+func (h CatalogHandler) Suppliers(w http.ResponseWriter, r *http.Request) {
+	query := supplierSelect
+	if !includeArchived(r) {
+		query += ` WHERE archived_at IS NULL`
+	}
+	query += ` ORDER BY name`
+
+	rows, err := h.DB.Query(query)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	out := []supplier{}
+	for rows.Next() {
+		var s supplier
+		if err := scanSupplier(rows, &s); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		out = append(out, s)
+	}
+	httpx.JSON(w, 200, out)
+}
+
+func (h CatalogHandler) GetSupplier(w http.ResponseWriter, r *http.Request) {
+	var s supplier
+	err := scanSupplier(h.DB.QueryRow(supplierSelect+` WHERE id = ?`, r.PathValue("id")), &s)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "supplier not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, 200, s)
+}
+
+type supplierReq struct {
+	Name         *string `json:"name"`
+	CRNumber     *string `json:"crNumber"`
+	VATNumber    *string `json:"vatNumber"`
+	Phone        *string `json:"phone"`
+	PaymentTerms *string `json:"paymentTerms"`
+	Archived     *bool   `json:"archived"`
+}
+
+// apply copies the fields present in req onto s.
+func (req supplierReq) apply(s *supplier) {
+	set := func(dst *string, v *string) {
+		if v != nil {
+			*dst = strings.TrimSpace(*v)
+		}
+	}
+	set(&s.Name, req.Name)
+	set(&s.CRNumber, req.CRNumber)
+	set(&s.VATNumber, req.VATNumber)
+	set(&s.Phone, req.Phone)
+	set(&s.PaymentTerms, req.PaymentTerms)
+}
+
+func (h CatalogHandler) CreateSupplier(w http.ResponseWriter, r *http.Request) {
+	var req supplierReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" {
+		httpx.JSON(w, 400, map[string]string{"error": "name is required"})
+		return
+	}
+
+	s := supplier{ID: uuid.NewString()}
+	req.apply(&s)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "suppliers", "id = ?", s.ID)
+	_, err = tx.Exec(`
+		INSERT INTO suppliers (id, name, cr_number, vat_number, phone, payment_terms)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, s.ID, s.Name, s.CRNumber, s.VATNumber, s.Phone, s.PaymentTerms)
+	if db.IsUniqueViolation(err) {
+		httpx.JSON(w, 409, map[string]string{"error": "a supplier with this name already exists"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Create) {
+		return
+	}
+	httpx.JSON(w, 201, s)
+}
+
+// UpdateSupplier edits a supplier's details and/or archives or restores it.
+func (h CatalogHandler) UpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req supplierReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		httpx.JSON(w, 400, map[string]string{"error": "name cannot be empty"})
+		return
+	}
+
+	var s supplier
+	err := scanSupplier(h.DB.QueryRow(supplierSelect+` WHERE id = ?`, id), &s)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "supplier not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	req.apply(&s)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "suppliers", "id = ?", id)
+	_, err = tx.Exec(`
+		UPDATE suppliers
+		SET name = ?, cr_number = ?, vat_number = ?, phone = ?, payment_terms = ?,
+			archived_at = CASE WHEN ? IS NULL THEN archived_at WHEN ? THEN COALESCE(archived_at, CURRENT_TIMESTAMP) ELSE NULL END
+		WHERE id = ?
+	`, s.Name, s.CRNumber, s.VATNumber, s.Phone, s.PaymentTerms, req.Archived, req.Archived, id)
+	if db.IsUniqueViolation(err) {
+		httpx.JSON(w, 409, map[string]string{"error": "a supplier with this name already exists"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Update) {
+		return
+	}
+
+	if err := h.DB.QueryRow(`SELECT archived_at FROM suppliers WHERE id = ?`, id).Scan(&s.ArchivedAt); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, 200, s)
+}
+
+// DeleteSupplier removes a supplier no expense or recurring expense refers
+// to; suppliers in use must be archived instead.
+func (h CatalogHandler) DeleteSupplier(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var used int
+	if err := tx.QueryRow(`SELECT COUNT(1) FROM expenses WHERE supplier_id = ?`, id).Scan(&used); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if used > 0 {
+		httpx.JSON(w, 409, map[string]string{"error": "supplier has expenses; archive it instead"})
+		return
+	}
+	if err := tx.QueryRow(`SELECT COUNT(1) FROM recurring_expenses WHERE supplier_id = ?`, id).Scan(&used); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if used > 0 {
+		httpx.JSON(w, 409, map[string]string{"error": "supplier is used by a recurring expense; pause/delete it or archive instead"})
+		return
+	}
+
+	change := audit.Track(tx, "suppliers", "id = ?", id)
+	res, err := tx.Exec(`DELETE FROM suppliers WHERE id = ?`, id)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "supplier not found"})
+		return
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Delete) {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
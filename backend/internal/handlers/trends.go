@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/money"
+	"almanarteen-backend/internal/recurring"
+)
+
+// maxTrendMonths bounds one trends request.
+const maxTrendMonths = 60
+
+// trendDelta compares a month with an earlier one. Percent is null when the
+// earlier month had no spending, since any change from zero is unbounded.
+type trendDelta struct {
+	Change  money.Fils `json:"change"`
+	Percent *float64   `json:"percent"`
+}
+
+func deltaOf(cur, prev money.Fils) trendDelta {
+	d := trendDelta{Change: cur - prev}
+	if prev != 0 {
+		p := float64(cur-prev) * 100 / float64(prev)
+		d.Percent = &p
+	}
+	return d
+}
+
+// trendPoint is one month of a series, compared with the month before (mom)
+// and the same month a year earlier (yoy).
+type trendPoint struct {
+	Month      string      `json:"month"` // YYYY-MM
+	Total      money.Fils  `json:"total"`
+	Budget     *money.Fils `json:"budget"`
+	OverBudget bool        `json:"overBudget"`
+	MoM        trendDelta  `json:"mom"`
+	YoY        trendDelta  `json:"yoy"`
+}
+
+type trendItem struct {
+	ItemID string       `json:"itemId"`
+	Item   string       `json:"item"`
+	Total  money.Fils   `json:"total"`
+	Months []trendPoint `json:"months"`
+}
+
+type trendCategory struct {
+	CategoryID string       `json:"categoryId"`
+	Category   string       `json:"category"`
+	Total      money.Fils   `json:"total"`
+	Months     []trendPoint `json:"months"`
+	Items      []trendItem  `json:"items,omitempty"`
+}
+
+// monthTotals is spending keyed by YYYY-MM, covering the requested range and
+// the twelve months before it for the year-over-year comparison.
+type monthTotals map[string]money.Fils
+
+// series builds the points for months from totals and, when given, budgets.
+func (t monthTotals) series(months []string, budgets map[string]money.Fils) ([]trendPoint, money.Fils) {
+	out := make([]trendPoint, len(months))
+	var sum money.Fils
+	for i, m := range months {
+		p := trendPoint{
+			Month: m,
+			Total: t[m],
+			MoM:   deltaOf(t[m], t[addMonths(m, -1)]),
+			YoY:   deltaOf(t[m], t[addMonths(m, -12)]),
+		}
+		if b, ok := budgets[m]; ok {
+			p.Budget = &b
+			p.OverBudget = p.Total > b
+		}
+		sum += p.Total
+		out[i] = p
+	}
+	return out, sum
+}
+
+func addMonths(month string, n int) string {
+	m, _ := time.Parse("2006-01", month)
+	return m.AddDate(0, n, 0).Format("2006-01")
+}
+
+// Trends returns monthly spending from ?from=YYYY-MM to ?to=YYYY-MM
+// (default: the twelve months ending with the current one), overall and per
+// category, with month-over-month and year-over-year deltas and the budget
+// set for each month. ?items=1 adds a per-item series under each category;
+// ?categoryId= limits the breakdown (not the overall series) to one category.
+func (h ReportsHandler) Trends(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	to := recurring.Today().Format("2006-01")
+	if v := q.Get("to"); v != "" {
+		to = v
+	}
+	from := addMonths(to, -11)
+	if v := q.Get("from"); v != "" {
+		from = v
+	}
+	toM, err1 := time.Parse("2006-01", to)
+	fromM, err2 := time.Parse("2006-01", from)
+	if err1 != nil || err2 != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "from and to must be YYYY-MM"})
+		return
+	}
+	if fromM.After(toM) {
+		httpx.JSON(w, 400, map[string]string{"error": "from must not be after to"})
+		return
+	}
+
+	var months []string
+	for m := fromM; !m.After(toM); m = m.AddDate(0, 1, 0) {
+		months = append(months, m.Format("2006-01"))
+	}
+	if len(months) > maxTrendMonths {
+		httpx.JSON(w, 400, map[string]string{"error": "the range may span at most 60 months"})
+		return
+	}
+
+	withItems := queryFlag(q.Get("items"))
+	onlyCategory := q.Get("categoryId")
+	since := addMonths(from, -12)
+
+	rows, err := h.DB.Query(`
+		SELECT substr(e.purchase_date, 1, 7) AS m, c.id, c.name, i.id, i.name, SUM(e.total_price_fils)
+		FROM expenses e
+		JOIN items i ON i.id = e.item_id
+		JOIN categories c ON c.id = i.category_id
+		WHERE substr(e.purchase_date, 1, 7) BETWEEN ? AND ?
+		GROUP BY m, c.id, i.id
+	`, since, to)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	type catAcc struct {
+		name   string
+		totals monthTotals
+		items  map[string]*trendItem
+		byItem map[string]monthTotals
+	}
+	overall := monthTotals{}
+	cats := map[string]*catAcc{}
+	category := func(id, name string) *catAcc {
+		c, ok := cats[id]
+		if !ok {
+			c = &catAcc{name: name, totals: monthTotals{}, items: map[string]*trendItem{}, byItem: map[string]monthTotals{}}
+			cats[id] = c
+		}
+		return c
+	}
+
+	for rows.Next() {
+		var m, catID, catName, itemID, itemName string
+		var total money.Fils
+		if err := rows.Scan(&m, &catID, &catName, &itemID, &itemName, &total); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		overall[m] += total
+		if onlyCategory != "" && catID != onlyCategory {
+			continue
+		}
+		c := category(catID, catName)
+		c.totals[m] += total
+		if withItems {
+			if c.byItem[itemID] == nil {
+				c.byItem[itemID] = monthTotals{}
+				c.items[itemID] = &trendItem{ItemID: itemID, Item: itemName}
+			}
+			c.byItem[itemID][m] += total
+		}
+	}
+	if err := rows.Err(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	budgets := map[string]money.Fils{}
+	brows, err := h.DB.Query(`
+		SELECT substr(month, 1, 7), max_budget_fils FROM monthly_budgets
+		WHERE substr(month, 1, 7) BETWEEN ? AND ?
+	`, from, to)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer brows.Close()
+	for brows.Next() {
+		var m string
+		var b money.Fils
+		if err := brows.Scan(&m, &b); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		budgets[m] = b
+	}
+	if err := brows.Err(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Categories capped in the range are listed even without spending.
+	catBudgets := map[string]map[string]money.Fils{}
+	cbrows, err := h.DB.Query(`
+		SELECT substr(cb.month, 1, 7), c.id, c.name, cb.max_budget_fils
+		FROM category_budgets cb
+		JOIN categories c ON c.id = cb.category_id
+		WHERE substr(cb.month, 1, 7) BETWEEN ? AND ?
+	`, from, to)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer cbrows.Close()
+	for cbrows.Next() {
+		var m, catID, catName string
+		var b money.Fils
+		if err := cbrows.Scan(&m, &catID, &catName, &b); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		if onlyCategory != "" && catID != onlyCategory {
+			continue
+		}
+		category(catID, catName)
+		if catBudgets[catID] == nil {
+			catBudgets[catID] = map[string]money.Fils{}
+		}
+		catBudgets[catID][m] = b
+	}
+	if err := cbrows.Err(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	series, total := overall.series(months, budgets)
+
+	byCategory := make([]trendCategory, 0, len(cats))
+	for id, c := range cats {
+		tc := trendCategory{CategoryID: id, Category: c.name}
+		tc.Months, tc.Total = c.totals.series(months, catBudgets[id])
+		for itemID, it := range c.items {
+			it.Months, it.Total = c.byItem[itemID].series(months, nil)
+			if it.Total != 0 {
+				tc.Items = append(tc.Items, *it)
+			}
+		}
+		if withItems && tc.Items == nil {
+			tc.Items = []trendItem{}
+		}
+		sort.Slice(tc.Items, func(i, j int) bool {
+			if tc.Items[i].Total != tc.Items[j].Total {
+				return tc.Items[i].Total > tc.Items[j].Total
+			}
+			return tc.Items[i].Item < tc.Items[j].Item
+		})
+		if tc.Total == 0 && catBudgets[id] == nil {
+			continue // spending only in the year before the range
+		}
+		byCategory = append(byCategory, tc)
+	}
+	sort.Slice(byCategory, func(i, j int) bool {
+		if byCategory[i].Total != byCategory[j].Total {
+			return byCategory[i].Total > byCategory[j].Total
+		}
+		return byCategory[i].Category < byCategory[j].Category
+	})
+
+	httpx.JSON(w, 200, map[string]any{
+		"from":       from,
+		"to":         to,
+		"total":      total,
+		"months":     series,
+		"byCategory": byCategory,
+	})
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/db"
+	"almanarteen-backend/internal/httpx"
+	"almanarteen-backend/internal/units"
+
+	"github.com/google/uuid"
+)
+
+type unit struct {
+	Code      string  `json:"code"`
+	Name      string  `json:"name"`
+	Dimension string  `json:"dimension"` // mass, volume or count
+	Factor    float64 `json:"factor"`    // g, ml or pcs in one
+}
+
+// Units lists the standard units quantities can be entered in.
+func (h CatalogHandler) Units(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`SELECT code, name, dimension, factor FROM units ORDER BY dimension, factor, code`)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	out := []unit{}
+	for rows.Next() {
+		var u unit
+		if err := rows.Scan(&u.Code, &u.Name, &u.Dimension, &u.Factor); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		out = append(out, u)
+	}
+	httpx.JSON(w, 200, out)
+}
+
+type itemPack struct {
+	ID       string  `json:"id"`
+	ItemID   string  `json:"itemId"`
+	Name     string  `json:"name"`
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+	// PerPack is Quantity converted to the item's unit.
+	PerPack float64 `json:"perPack"`
+}
+
+// ItemPacks lists the packs an item is bought in.
+func (h CatalogHandler) ItemPacks(w http.ResponseWriter, r *http.Request) {
+	itemID := r.PathValue("id")
+
+	rows, err := h.DB.Query(`SELECT id, item_id, name, quantity, unit FROM item_packs WHERE item_id = ? ORDER BY name`, itemID)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	out := []itemPack{}
+	for rows.Next() {
+		var p itemPack
+		if err := rows.Scan(&p.ID, &p.ItemID, &p.Name, &p.Quantity, &p.Unit); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		out = append(out, p)
+	}
+	rows.Close()
+
+	for i := range out {
+		f, err := units.Factor(h.DB, itemID, out[i].Name)
+		if err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		out[i].PerPack = f
+	}
+	httpx.JSON(w, 200, out)
+}
+
+type itemPackReq struct {
+	Name     string  `json:"name"`
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+}
+
+// CreateItemPack defines a pack of an item, e.g. {"name": "tin",
+// "quantity": 18, "unit": "liter"}. The unit must convert to the item's.
+func (h CatalogHandler) CreateItemPack(w http.ResponseWriter, r *http.Request) {
+	itemID := r.PathValue("id")
+
+	var req itemPackReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	p := itemPack{
+		ID:       uuid.NewString(),
+		ItemID:   itemID,
+		Name:     strings.TrimSpace(req.Name),
+		Quantity: req.Quantity,
+		Unit:     strings.TrimSpace(req.Unit),
+	}
+	if p.Name == "" || p.Unit == "" || p.Quantity <= 0 {
+		httpx.JSON(w, 400, map[string]string{"error": "name, a positive quantity and unit are required"})
+		return
+	}
+	if strings.EqualFold(p.Name, p.Unit) {
+		httpx.JSON(w, 400, map[string]string{"error": "a pack cannot be defined in terms of itself"})
+		return
+	}
+	if std, err := units.IsStandard(h.DB, p.Name); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	} else if std {
+		httpx.JSON(w, 400, map[string]string{"error": p.Name + " is a standard unit"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(1) FROM items WHERE id = ?`, itemID).Scan(&n); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n == 0 {
+		httpx.JSON(w, 404, map[string]string{"error": "item not found"})
+		return
+	}
+
+	_, err = tx.Exec(`INSERT INTO item_packs (id, item_id, name, quantity, unit) VALUES (?, ?, ?, ?, ?)`,
+		p.ID, p.ItemID, p.Name, p.Quantity, p.Unit)
+	if db.IsUniqueViolation(err) {
+		httpx.JSON(w, 409, map[string]string{"error": "the item already has a pack with this name"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Resolving the new pack checks its unit converts to the item's.
+	p.PerPack, err = units.Factor(tx, itemID, p.Name)
+	if msg, ok := unitError(err); ok {
+		httpx.JSON(w, 400, map[string]string{"error": msg})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := audit.Inserted("item_packs", "id = ?", p.ID).Record(tx, audit.ActorFrom(r), audit.Create); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	httpx.JSON(w, 201, p)
+}
+
+// DeleteItemPack removes a pack. Expenses entered in it keep their
+// converted quantity.
+func (h CatalogHandler) DeleteItemPack(w http.ResponseWriter, r *http.Request) {
+	var name string
+	err := h.DB.QueryRow(`SELECT name FROM item_packs WHERE id = ? AND item_id = ?`, r.PathValue("packId"), r.PathValue("id")).Scan(&name)
+	if err == sql.ErrNoRows {
+		httpx.JSON(w, 404, map[string]string{"error": "pack not found"})
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Other packs may be defined in terms of this one.
+	var n int
+	if err := h.DB.QueryRow(`SELECT COUNT(1) FROM item_packs WHERE item_id = ? AND unit = ?`, r.PathValue("id"), name).Scan(&n); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n > 0 {
+		httpx.JSON(w, 409, map[string]string{"error": "other packs of the item are defined in " + name})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "item_packs", "id = ?", r.PathValue("packId"))
+	if _, err := tx.Exec(`DELETE FROM item_packs WHERE id = ?`, r.PathValue("packId")); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if !commitAudited(w, r, tx, change, audit.Delete) {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/auth"
+	"almanarteen-backend/internal/httpx"
+)
+
+type UsersHandler struct{ DB *sql.DB }
+
+type user struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Email      string  `json:"email"`
+	Role       string  `json:"role"`
+	DisabledAt *string `json:"disabledAt"`
+	CreatedAt  string  `json:"createdAt"`
+}
+
+// userError maps auth user errors to an HTTP status, falling back to 500.
+func userError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound):
+		httpx.JSON(w, 404, map[string]string{"error": err.Error()})
+	case errors.Is(err, auth.ErrEmailTaken):
+		httpx.JSON(w, 409, map[string]string{"error": err.Error()})
+	case errors.Is(err, auth.ErrInvalidRole), errors.Is(err, auth.ErrWeakPassword):
+		httpx.JSON(w, 400, map[string]string{"error": err.Error()})
+	default:
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+	}
+}
+
+func (h UsersHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`
+		SELECT id, name, email, role, disabled_at, created_at
+		FROM users
+		ORDER BY name
+	`)
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	out := []user{}
+	for rows.Next() {
+		var u user
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Role, &u.DisabledAt, &u.CreatedAt); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+		out = append(out, u)
+	}
+
+	httpx.JSON(w, 200, out)
+}
+
+type createUserReq struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	Password string `json:"password"` // optional; generated when empty
+}
+
+// CreateUser invites a user. Without a password a temporary one is generated
+// and returned once so it can be handed over.
+func (h UsersHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" || !strings.Contains(req.Email, "@") || req.Role == "" {
+		httpx.JSON(w, 400, map[string]string{"error": "name, email and role are required"})
+		return
+	}
+
+	resp := map[string]any{}
+	if req.Password == "" {
+		req.Password = auth.RandomPassword()
+		resp["temporaryPassword"] = req.Password
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	id, err := auth.CreateUser(tx, req.Name, req.Email, req.Password, req.Role)
+	if err != nil {
+		userError(w, err)
+		return
+	}
+
+	if !commitAudited(w, r, tx, audit.Inserted("users", "id = ?", id), audit.Create) {
+		return
+	}
+	resp["id"] = id
+	httpx.JSON(w, 201, resp)
+}
+
+type updateUserReq struct {
+	Name *string `json:"name"`
+	Role *string `json:"role"`
+}
+
+func (h UsersHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	me := auth.UserIDFromContext(r)
+	id := r.PathValue("id")
+
+	var req updateUserReq
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.JSON(w, 400, map[string]string{"error": "invalid json"})
+		return
+	}
+	if req.Name == nil && req.Role == nil {
+		httpx.JSON(w, 400, map[string]string{"error": "nothing to update; send name and/or role"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(1) FROM users WHERE id = ?`, id).Scan(&n); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if n == 0 {
+		userError(w, auth.ErrUserNotFound)
+		return
+	}
+
+	change := audit.Track(tx, "users", "id = ?", id)
+
+	if req.Role != nil {
+		if id == me && *req.Role != auth.RoleFromContext(r) {
+			httpx.JSON(w, 400, map[string]string{"error": "you cannot change your own role"})
+			return
+		}
+		if err := auth.SetRole(tx, id, *req.Role); err != nil {
+			userError(w, err)
+			return
+		}
+	}
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			httpx.JSON(w, 400, map[string]string{"error": "name cannot be empty"})
+			return
+		}
+		if _, err := tx.Exec(`UPDATE users SET name = ? WHERE id = ?`, strings.TrimSpace(*req.Name), id); err != nil {
+			httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	if !commitAudited(w, r, tx, change, audit.Update) {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+// DeactivateUser blocks sign-in and revokes the user's sessions at once.
+func (h UsersHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == auth.UserIDFromContext(r) {
+		httpx.JSON(w, 400, map[string]string{"error": "you cannot deactivate yourself"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "users", "id = ?", id)
+	if err := auth.SetDisabled(tx, id, true); err != nil {
+		userError(w, err)
+		return
+	}
+	if !commitAudited(w, r, tx, change, "deactivate") {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+func (h UsersHandler) ActivateUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "users", "id = ?", id)
+	if err := auth.SetDisabled(tx, id, false); err != nil {
+		userError(w, err)
+		return
+	}
+	if !commitAudited(w, r, tx, change, "activate") {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
+
+// UnlockUser lifts a login lockout by forgetting the user's failed attempts.
+func (h UsersHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	var email string
+	err := h.DB.QueryRow(`SELECT email FROM users WHERE id = ?`, r.PathValue("id")).Scan(&email)
+	if err == sql.ErrNoRows {
+		userError(w, auth.ErrUserNotFound)
+		return
+	}
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	change := audit.Track(tx, "users", "id = ?", r.PathValue("id"))
+	if err := auth.UnlockLogin(tx, email); err != nil {
+		httpx.JSON(w, 500, map[string]string{"error": err.Error()})
+		return
+	}
+	if !commitAudited(w, r, tx, change, "unlock") {
+		return
+	}
+	httpx.JSON(w, 200, map[string]any{"ok": true})
+}
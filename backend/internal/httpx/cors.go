@@ -43,7 +43,8 @@ func CORS(allowedExact []string, vercelProjectPrefix string, next http.Handler)
 			w.Header().Set("Vary", "Origin")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 			w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, X-Total-Count, X-Next-Cursor")
 		}
 
 		// Preflight
@@ -0,0 +1,27 @@
+package httpx
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustProxy makes ClientIP believe X-Forwarded-For. Only enable it when the
+// API sits behind a proxy that sets the header, or clients can spoof it.
+var TrustProxy bool
+
+// ClientIP returns the address of the client that sent r.
+func ClientIP(r *http.Request) string {
+	if TrustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			// the proxy appends the address it saw last
+			parts := strings.Split(xff, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
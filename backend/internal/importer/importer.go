@@ -0,0 +1,457 @@
+// Package importer loads historical expenses from CSV. The whole file is
+// read and parsed first; the rows are then resolved against the catalog and
+// inserted inside one transaction, which is committed only when no row has an
+// error and dry-run is off, so an import either lands completely or not at
+// all.
+package importer
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/ledger"
+	"almanarteen-backend/internal/money"
+	"almanarteen-backend/internal/periods"
+
+	"github.com/google/uuid"
+)
+
+// Fields that a CSV column can map to. Date, item, quantity and unit price
+// are required; category is needed to create missing items and to tell
+// apart items that share a name.
+const (
+	FieldDate      = "date"
+	FieldCategory  = "category"
+	FieldItem      = "item"
+	FieldUnit      = "unit"
+	FieldQuantity  = "quantity"
+	FieldUnitPrice = "unitPrice"
+	FieldNote      = "note"
+)
+
+// headerAliases are the header names recognised for each field, compared
+// case-insensitively with spaces, dashes and underscores ignored.
+var headerAliases = map[string][]string{
+	FieldDate:      {"date", "purchasedate", "day"},
+	FieldCategory:  {"category", "categoryname"},
+	FieldItem:      {"item", "itemname", "product", "description"},
+	FieldUnit:      {"unit", "uom"},
+	FieldQuantity:  {"quantity", "qty"},
+	FieldUnitPrice: {"unitprice", "price", "priceperunit", "unitpricebd"},
+	FieldNote:      {"note", "notes", "comment", "remarks"},
+}
+
+// defaultUnit is given to items created for rows without a unit column.
+const defaultUnit = "piece"
+
+// MaxRows bounds one import: the rows are held in memory and inserted while
+// holding the write lock.
+const MaxRows = 20000
+
+var ErrNoRows = errors.New("the file has no data rows")
+
+type Options struct {
+	// CreatedBy is the user the expenses are recorded against.
+	CreatedBy string
+	// Actor is who the audit log attributes the created rows to.
+	Actor audit.Actor
+	// CreateMissing adds unknown categories and items instead of failing
+	// the rows that use them.
+	CreateMissing bool
+	// DryRun validates everything and rolls back.
+	DryRun bool
+	// Columns overrides header detection: field -> header name as in the file.
+	Columns map[string]string
+}
+
+type RowError struct {
+	Row   int    `json:"row"` // line number in the file, header is 1
+	Error string `json:"error"`
+}
+
+type Result struct {
+	Rows              int        `json:"rows"`
+	Valid             int        `json:"valid"`
+	Imported          int        `json:"imported"` // 0 unless committed
+	Total             money.Fils `json:"total"`
+	CreatedCategories []string   `json:"createdCategories"`
+	CreatedItems      []string   `json:"createdItems"`
+	Errors            []RowError `json:"errors"`
+	DryRun            bool       `json:"dryRun"`
+	Committed         bool       `json:"committed"`
+	Months            []string   `json:"months"` // YYYY-MM of the valid rows
+}
+
+// Import reads CSV from r and records its rows as expenses. Per-row problems
+// are reported in Result.Errors; the returned error is for problems with the
+// file as a whole or the database.
+func Import(conn *sql.DB, r io.Reader, opts Options) (Result, error) {
+	res := Result{DryRun: opts.DryRun, CreatedCategories: []string{}, CreatedItems: []string{}, Errors: []RowError{}, Months: []string{}}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return res, ErrNoRows
+	}
+	if err != nil {
+		return res, err
+	}
+	cols, err := mapColumns(header, opts.Columns)
+	if err != nil {
+		return res, err
+	}
+
+	// Read the whole file before opening the transaction, so a slow upload
+	// does not hold the write lock.
+	var parsed []parsedRow
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				return res, fmt.Errorf("line %d: %w", perr.Line, perr.Err)
+			}
+			return res, err
+		}
+		if blank(rec) {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+
+		res.Rows++
+		if res.Rows > MaxRows {
+			return res, fmt.Errorf("the file has more than %d rows; split it", MaxRows)
+		}
+
+		e, err := parseRow(rec, cols)
+		parsed = append(parsed, parsedRow{
+			line:     line,
+			expense:  e,
+			category: cols.get(rec, FieldCategory),
+			item:     cols.get(rec, FieldItem),
+			err:      err,
+		})
+	}
+	if res.Rows == 0 {
+		return res, ErrNoRows
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	cat, err := loadCatalog(tx)
+	if err != nil {
+		return res, err
+	}
+	cat.actor = opts.Actor
+
+	for _, p := range parsed {
+		e, err := p.expense, p.err
+		if err == nil {
+			e.ItemID, err = cat.resolve(tx, p.category, p.item, e.Unit, opts.CreateMissing, &res)
+		}
+		if err == nil {
+			// Quantity and price may be in another unit than the item's.
+			_, err = ledger.Normalize(tx, e)
+		}
+		if err == nil {
+			err = periods.CheckOpen(tx, e.Date)
+		}
+		if err != nil {
+			res.Errors = append(res.Errors, RowError{Row: p.line, Error: err.Error()})
+			continue
+		}
+
+		e.CreatedBy = opts.CreatedBy
+		id, a, err := ledger.Insert(tx, e)
+		if err == nil {
+			err = audit.Inserted("expenses", "id = ?", id).Record(tx, opts.Actor, audit.Create)
+		}
+		if err != nil {
+			return res, fmt.Errorf("line %d: %w", p.line, err)
+		}
+		res.Total += a.Total
+		if m := e.Date[:7]; !slices.Contains(res.Months, m) {
+			res.Months = append(res.Months, m)
+		}
+	}
+	slices.Sort(res.Months)
+
+	res.Valid = res.Rows - len(res.Errors)
+	if opts.DryRun || len(res.Errors) > 0 {
+		return res, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return res, err
+	}
+	res.Committed = true
+	res.Imported = res.Rows
+	return res, nil
+}
+
+// parsedRow is a data row read from the file, or the reason it could not be
+// parsed.
+type parsedRow struct {
+	line           int
+	expense        ledger.Expense
+	category, item string
+	err            error
+}
+
+// columns maps fields to their index in a record.
+type columns map[string]int
+
+func (c columns) get(rec []string, field string) string {
+	i, ok := c[field]
+	if !ok || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+func mapColumns(header []string, override map[string]string) (columns, error) {
+	norm := func(s string) string {
+		s = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(s, "\ufeff")))
+		return strings.NewReplacer(" ", "", "_", "", "-", "", "(", "", ")", "").Replace(s)
+	}
+
+	byName := map[string]int{}
+	for i, h := range header {
+		if _, dup := byName[norm(h)]; !dup {
+			byName[norm(h)] = i
+		}
+	}
+
+	cols := columns{}
+	for field, aliases := range headerAliases {
+		if name, ok := override[field]; ok {
+			i, found := byName[norm(name)]
+			if !found {
+				return nil, fmt.Errorf("column %q (for %s) is not in the header", name, field)
+			}
+			cols[field] = i
+			continue
+		}
+		for _, a := range aliases {
+			if i, ok := byName[a]; ok {
+				cols[field] = i
+				break
+			}
+		}
+	}
+	for field := range override {
+		if _, ok := headerAliases[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	var missing []string
+	for _, f := range []string{FieldDate, FieldItem, FieldQuantity, FieldUnitPrice} {
+		if _, ok := cols[f]; !ok {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required columns: %s", strings.Join(missing, ", "))
+	}
+	return cols, nil
+}
+
+// dateLayouts are tried in order. Day-first is used for slashed dates, as
+// written in Bahrain.
+var dateLayouts = []string{"2006-01-02", "02/01/2006", "2/1/2006", "02-01-2006", "2006/01/02"}
+
+func parseRow(rec []string, cols columns) (ledger.Expense, error) {
+	var e ledger.Expense
+
+	date := cols.get(rec, FieldDate)
+	var d time.Time
+	var err error
+	for _, layout := range dateLayouts {
+		if d, err = time.Parse(layout, date); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return e, fmt.Errorf("date %q is not YYYY-MM-DD or DD/MM/YYYY", date)
+	}
+	e.Date = d.Format("2006-01-02")
+
+	if cols.get(rec, FieldItem) == "" {
+		return e, errors.New("item is empty")
+	}
+
+	q, err := strconv.ParseFloat(strings.ReplaceAll(cols.get(rec, FieldQuantity), ",", ""), 64)
+	if err != nil || q <= 0 {
+		return e, fmt.Errorf("quantity %q must be a positive number", cols.get(rec, FieldQuantity))
+	}
+	e.Quantity = q
+
+	price := strings.ReplaceAll(cols.get(rec, FieldUnitPrice), ",", "")
+	price = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.ToUpper(price), "BD"), "BD"))
+	p, err := money.Parse(price)
+	if err != nil || p <= 0 {
+		return e, fmt.Errorf("unit price %q must be a positive BD amount with at most 3 decimals", cols.get(rec, FieldUnitPrice))
+	}
+	e.UnitPrice = p
+
+	e.Unit = cols.get(rec, FieldUnit)
+	e.Note = cols.get(rec, FieldNote)
+	return e, nil
+}
+
+func blank(rec []string) bool {
+	for _, f := range rec {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// catalog indexes categories and items by lower-cased name for matching.
+type catalog struct {
+	categories map[string]string            // name -> id
+	items      map[string]map[string]string // item name -> category id -> item id
+	// archived holds archived categories and the items archived themselves
+	// or through their category. Their names stay taken, so rows naming
+	// them are refused rather than creating them again.
+	archived map[string]bool
+	actor    audit.Actor // for the audit entries of created rows
+}
+
+func loadCatalog(tx *sql.Tx) (*catalog, error) {
+	c := &catalog{categories: map[string]string{}, items: map[string]map[string]string{}, archived: map[string]bool{}}
+
+	rows, err := tx.Query(`SELECT id, name, archived_at IS NOT NULL FROM categories`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, name string
+		var archived bool
+		if err := rows.Scan(&id, &name, &archived); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.categories[strings.ToLower(name)] = id
+		c.archived[id] = archived
+	}
+	rows.Close()
+
+	rows, err = tx.Query(`
+		SELECT i.id, i.category_id, i.name, i.archived_at IS NOT NULL OR c.archived_at IS NOT NULL
+		FROM items i
+		JOIN categories c ON c.id = i.category_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, catID, name string
+		var archived bool
+		if err := rows.Scan(&id, &catID, &name, &archived); err != nil {
+			return nil, err
+		}
+		c.addItem(name, catID, id)
+		c.archived[id] = archived
+	}
+	return c, rows.Err()
+}
+
+func (c *catalog) addItem(name, categoryID, id string) {
+	k := strings.ToLower(name)
+	if c.items[k] == nil {
+		c.items[k] = map[string]string{}
+	}
+	c.items[k][categoryID] = id
+}
+
+// resolve finds the item a row refers to, creating the category and item
+// when allowed.
+func (c *catalog) resolve(tx *sql.Tx, category, item, unit string, create bool, res *Result) (string, error) {
+	byCat := c.items[strings.ToLower(item)]
+
+	if category == "" {
+		// Archived items only matter when no active one has the name.
+		var active []string
+		for _, id := range byCat {
+			if !c.archived[id] {
+				active = append(active, id)
+			}
+		}
+		switch {
+		case len(active) == 1:
+			return active[0], nil
+		case len(active) == 0 && len(byCat) > 0:
+			return "", fmt.Errorf("item %q is archived", item)
+		case len(active) == 0:
+			if create {
+				return "", fmt.Errorf("unknown item %q; a category is needed to create it", item)
+			}
+			return "", fmt.Errorf("unknown item %q", item)
+		}
+		return "", fmt.Errorf("item %q exists in several categories; add a category column", item)
+	}
+
+	catID, ok := c.categories[strings.ToLower(category)]
+	if ok && c.archived[catID] {
+		return "", fmt.Errorf("category %q is archived", category)
+	}
+	if !ok {
+		if !create {
+			return "", fmt.Errorf("unknown category %q", category)
+		}
+		catID = uuid.NewString()
+		if _, err := tx.Exec(`INSERT INTO categories (id, name) VALUES (?, ?)`, catID, category); err != nil {
+			return "", err
+		}
+		if err := audit.Inserted("categories", "id = ?", catID).Record(tx, c.actor, audit.Create); err != nil {
+			return "", err
+		}
+		c.categories[strings.ToLower(category)] = catID
+		res.CreatedCategories = append(res.CreatedCategories, category)
+	}
+
+	if id, ok := byCat[catID]; ok {
+		if c.archived[id] {
+			return "", fmt.Errorf("item %q is archived", item)
+		}
+		return id, nil
+	}
+	if !create {
+		return "", fmt.Errorf("unknown item %q in category %q", item, category)
+	}
+
+	if unit == "" {
+		unit = defaultUnit
+	}
+	id := uuid.NewString()
+	if _, err := tx.Exec(`INSERT INTO items (id, category_id, name, unit) VALUES (?, ?, ?, ?)`, id, catID, item, unit); err != nil {
+		return "", err
+	}
+	if err := audit.Inserted("items", "id = ?", id).Record(tx, c.actor, audit.Create); err != nil {
+		return "", err
+	}
+	c.addItem(item, catID, id)
+	res.CreatedItems = append(res.CreatedItems, category+" / "+item)
+	return id, nil
+}
@@ -0,0 +1,119 @@
+// Package ledger records expenses. It is the single write path shared by the
+// API, the CSV importer and other producers, so amounts and VAT are always
+// derived the same way.
+package ledger
+
+import (
+	"database/sql"
+	"math"
+
+	"almanarteen-backend/internal/money"
+	"almanarteen-backend/internal/periods"
+	"almanarteen-backend/internal/units"
+	"almanarteen-backend/internal/vat"
+
+	"github.com/google/uuid"
+)
+
+// DB is satisfied by *sql.DB and *sql.Tx.
+type DB interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Expense is a new expense as entered. Fields are expected to be validated
+// by the caller; VATCategory defaults to exempt.
+type Expense struct {
+	Date     string // YYYY-MM-DD
+	ItemID   string
+	Quantity float64
+	// Unit is what Quantity and UnitPrice are in: a standard unit or a pack
+	// of the item. Empty means the item's own unit.
+	Unit         string
+	UnitPrice    money.Fils
+	Note         string
+	SupplierID   string // optional
+	VATCategory  vat.Category
+	VATInclusive bool
+	CreatedBy    string
+	RecurringID  string // template the expense was generated from, if any
+}
+
+// Amounts are the derived money columns of a recorded expense.
+type Amounts struct {
+	Net   money.Fils `json:"net"`
+	VAT   money.Fils `json:"vat"`
+	Total money.Fils `json:"total"` // gross
+}
+
+// Compute derives the amounts of e at the current rate of its VAT category.
+// The amounts come from the price as entered, before any unit conversion,
+// so the total matches the invoice.
+func Compute(e Expense) Amounts {
+	cat := e.VATCategory
+	if cat == "" {
+		cat = vat.Exempt
+	}
+	net, tax, gross := vat.Split(e.UnitPrice.Mul(e.Quantity), cat.Rate(), e.VATInclusive)
+	return Amounts{Net: net, VAT: tax, Total: gross}
+}
+
+// Insert records e and returns its new id and amounts. The quantity and
+// unit price are stored in the item's unit; see units.Factor for the errors
+// an unconvertible Unit gives. A date in a closed month gives a
+// *periods.ClosedError.
+func Insert(db DB, e Expense) (string, Amounts, error) {
+	if e.VATCategory == "" {
+		e.VATCategory = vat.Exempt
+	}
+	a := Compute(e)
+
+	if err := periods.CheckOpen(db, e.Date); err != nil {
+		return "", Amounts{}, err
+	}
+
+	n, err := Normalize(db, e)
+	if err != nil {
+		return "", Amounts{}, err
+	}
+
+	id := uuid.NewString()
+	_, err = db.Exec(`
+		INSERT INTO expenses (id, purchase_date, item_id, quantity, unit_price_fils, total_price_fils,
+			net_fils, vat_fils, vat_category, vat_rate_bp, vat_inclusive, note, supplier_id, created_by,
+			entered_quantity, entered_unit, entered_unit_price_fils, recurring_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, NULLIF(?, ''))
+	`, id, e.Date, e.ItemID, n.Quantity, n.UnitPrice, a.Total,
+		a.Net, a.VAT, e.VATCategory, e.VATCategory.Rate(), e.VATInclusive, e.Note, e.SupplierID, e.CreatedBy,
+		n.EnteredQuantity, n.EnteredUnit, n.EnteredUnitPrice, e.RecurringID)
+	if err != nil {
+		return "", Amounts{}, err
+	}
+	return id, a, nil
+}
+
+// Normalized is an expense's quantity and unit price in the item's unit,
+// with what was entered when that was another unit (nil otherwise).
+type Normalized struct {
+	Quantity         float64
+	UnitPrice        money.Fils
+	EnteredQuantity  *float64
+	EnteredUnit      *string
+	EnteredUnitPrice *money.Fils
+}
+
+// Normalize converts the quantity and unit price of e to the item's unit.
+func Normalize(db units.Querier, e Expense) (Normalized, error) {
+	f, err := units.Factor(db, e.ItemID, e.Unit)
+	if err != nil {
+		return Normalized{}, err
+	}
+	n := Normalized{Quantity: e.Quantity, UnitPrice: e.UnitPrice}
+	if f == 1 {
+		return n, nil
+	}
+	n.Quantity = e.Quantity * f
+	n.UnitPrice = money.Fils(math.Round(float64(e.UnitPrice) / f))
+	n.EnteredQuantity, n.EnteredUnit, n.EnteredUnitPrice = &e.Quantity, &e.Unit, &e.UnitPrice
+	return n, nil
+}
@@ -0,0 +1,104 @@
+// Package money represents Bahraini dinar amounts exactly, as integer fils
+// (1 BD = 1000 fils). Amounts travel through JSON as plain decimal numbers
+// with up to three decimal places, e.g. 1.235.
+package money
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FilsPerDinar is the number of minor units in one Bahraini dinar.
+const FilsPerDinar = 1000
+
+// Fils is an amount of money in Bahraini fils.
+type Fils int64
+
+var ErrInvalid = errors.New("amount must be in BD with at most 3 decimals")
+
+// Parse reads a decimal dinar amount such as "12", "1.5" or "1.235".
+func Parse(s string) (Fils, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || len(frac) > 3 {
+		return 0, ErrInvalid
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	frac += strings.Repeat("0", 3-len(frac))
+
+	for _, part := range []string{whole, frac} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, ErrInvalid
+			}
+		}
+	}
+
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || w > math.MaxInt64/FilsPerDinar-1 {
+		return 0, ErrInvalid
+	}
+	f, _ := strconv.ParseInt(frac, 10, 64)
+
+	v := Fils(w*FilsPerDinar + f)
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+// String formats the amount as dinars with exactly three decimals.
+func (f Fils) String() string {
+	sign := ""
+	v := int64(f)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return sign + strconv.FormatInt(v/FilsPerDinar, 10) + "." + leftPad(strconv.FormatInt(v%FilsPerDinar, 10))
+}
+
+func leftPad(s string) string {
+	return strings.Repeat("0", 3-len(s)) + s
+}
+
+// MarshalJSON writes the amount as a JSON number in dinars.
+func (f Fils) MarshalJSON() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string in dinars.
+func (f *Fils) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	if strings.ContainsAny(s, "eE") {
+		// Exponent notation (e.g. 1e-3) only comes from float encoders.
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return ErrInvalid
+		}
+		s = strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*f = v
+	return nil
+}
+
+// Mul returns the amount multiplied by a (possibly fractional) quantity,
+// rounded half away from zero to the nearest fils.
+func (f Fils) Mul(qty float64) Fils {
+	return Fils(math.Round(float64(f) * qty))
+}
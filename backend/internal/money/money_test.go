@@ -0,0 +1,140 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Fils
+		ok   bool
+	}{
+		{"12", 12000, true},
+		{"1.5", 1500, true},
+		{"1.235", 1235, true},
+		{"0.001", 1, true},
+		{".5", 500, true},
+		{"1.", 1000, true},
+		{" 2.250 ", 2250, true},
+		{"-1.5", -1500, true},
+		{"-0.001", -1, true},
+		{"9223372036854774", 9223372036854774000, true},
+
+		{"1.2345", 0, false}, // four decimals
+		{"0.0005", 0, false},
+		{"", 0, false},
+		{".", 0, false},
+		{"-", 0, false},
+		{"+1", 0, false},
+		{"1,5", 0, false},
+		{"1.2.3", 0, false},
+		{"abc", 0, false},
+		{"1e3", 0, false}, // exponents are only accepted from JSON
+		{"9223372036854775", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.ok && (err != nil || got != tt.want) {
+			t.Errorf("Parse(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("Parse(%q) = %d; want error", tt.in, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Fils
+		want string
+	}{
+		{0, "0.000"},
+		{1, "0.001"},
+		{1235, "1.235"},
+		{12000, "12.000"},
+		{-1, "-0.001"},
+		{-1500, "-1.500"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Fils(%d).String() = %q; want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Fils
+		ok   bool
+	}{
+		{`1.235`, 1235, true},
+		{`"1.235"`, 1235, true},
+		{`-2.5`, -2500, true},
+		{`"-2.5"`, -2500, true},
+		{`1e-3`, 1, true},
+		{`1.2345E3`, 1234500, true},
+		{`"5e2"`, 500000, true},
+		{`-1e-3`, -1, true},
+		{`null`, 7, true}, // left untouched
+
+		{`1e-4`, 0, false},
+		{`1.0005`, 0, false},
+		{`"x"`, 0, false},
+		{`1e`, 0, false},
+		{`true`, 0, false},
+	}
+	for _, tt := range tests {
+		f := Fils(7)
+		err := json.Unmarshal([]byte(tt.in), &f)
+		if tt.ok && (err != nil || f != tt.want) {
+			t.Errorf("Unmarshal(%s) = %d, %v; want %d", tt.in, f, err, tt.want)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("Unmarshal(%s) = %d; want error", tt.in, f)
+		}
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, f := range []Fils{0, 1, 999, 1000, 1235, -1, -1235} {
+		b, err := json.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Fils
+		if err := json.Unmarshal(b, &back); err != nil || back != f {
+			t.Errorf("round trip of %d via %s = %d, %v", int64(f), b, back, err)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		f    Fils
+		qty  float64
+		want Fils
+	}{
+		{1235, 1, 1235},
+		{1235, 2, 2470},
+		{1000, 0.5, 500},
+		{1000, 0.0005, 1}, // half a fils rounds away from zero
+		{1000, 0.0004, 0},
+		{1, 0.5, 1},
+		{1, 1.5, 2},
+		{1, 2.5, 3},
+		{-1, 0.5, -1},
+		{-1000, 0.0005, -1},
+		{1005, 0.5, 503},
+		{333, 3, 999},
+		{1000, 1.0 / 3, 333},
+		{1500, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.f.Mul(tt.qty); got != tt.want {
+			t.Errorf("Fils(%d).Mul(%v) = %d; want %d", int64(tt.f), tt.qty, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package notify delivers messages to people (password reset links, alerts)
+// through a pluggable channel so the rest of the code never talks SMTP
+// directly and local setups can write messages to a file instead.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
+var ErrBadRecipient = errors.New("notify: recipient contains a line break")
+
+// headerText makes s safe for a single mail header line. Subjects can carry
+// user-entered text such as category names, so line breaks are folded into
+// spaces rather than letting them start a new header.
+func headerText(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '\r' || r == '\n' }), " ")
+}
+
+// FromEnv picks a notifier from the environment: SMTP when SMTP_HOST is set,
+// a file when NOTIFY_FILE is set, the process log otherwise.
+func FromEnv() Notifier {
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return SMTP{
+			Addr:     host + ":" + port,
+			From:     os.Getenv("SMTP_FROM"),
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	}
+	if path := os.Getenv("NOTIFY_FILE"); path != "" {
+		return &File{Path: path}
+	}
+	return Log{}
+}
+
+// Log writes messages to the standard logger. Meant for development only.
+type Log struct{}
+
+func (Log) Notify(_ context.Context, m Message) error {
+	log.Printf("notify to=%s subject=%q\n%s", m.To, m.Subject, m.Body)
+	return nil
+}
+
+// File appends messages to a local file, e.g. to pick up reset links in
+// tests or on a machine without a mail server.
+type File struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (f *File) Notify(_ context.Context, m Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fh, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	_, err = fmt.Fprintf(fh, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().UTC().Format(time.RFC3339), headerText(m.To), headerText(m.Subject), m.Body)
+	return err
+}
+
+// SMTP sends plain-text mail. Username may be empty for relays without auth.
+type SMTP struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+// Notify sends m, giving up when ctx is done: the connection is closed
+// then, whatever step the exchange is at.
+func (s SMTP) Notify(ctx context.Context, m Message) (err error) {
+	if strings.ContainsAny(m.To, "\r\n") {
+		return ErrBadRecipient
+	}
+
+	host, _, _ := strings.Cut(s.Addr, ":")
+	var a smtp.Auth
+	if s.Username != "" {
+		a = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + m.To + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", headerText(m.Subject)) + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + m.Body + "\r\n"
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err() // rather than the closed connection's error
+		}
+	}()
+
+	// The same steps as smtp.SendMail, which has no way to take ctx.
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(m.To); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Webhook posts each message as JSON ({"to","subject","body"}) to URL, e.g.
+// a chat integration. Any 2xx response counts as delivered.
+type Webhook struct {
+	URL    string
+	Client *http.Client // nil means a client with a 10s timeout
+}
+
+func (h Webhook) Notify(ctx context.Context, m Message) error {
+	body, err := json.Marshal(map[string]string{"to": m.To, "subject": m.Subject, "body": m.Body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	c := h.Client
+	if c == nil {
+		c = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
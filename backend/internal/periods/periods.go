@@ -0,0 +1,59 @@
+// Package periods locks reconciled months. Every path that writes expenses
+// checks here first, so a closed month stays as the accountant left it.
+package periods
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Querier is satisfied by *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// ClosedError reports a change to an expense dated in a closed month.
+type ClosedError struct {
+	Month string // YYYY-MM
+}
+
+func (e *ClosedError) Error() string {
+	return fmt.Sprintf("%s %s", e.Month, closedMessage)
+}
+
+// closedMessage is also what the triggers of migration 023 abort with, for
+// writes that got past CheckOpen.
+const closedMessage = "is closed; expenses in it cannot be added, changed or deleted until it is reopened"
+
+// IsViolation reports whether err is a write the closed-month triggers
+// refused.
+func IsViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), closedMessage)
+}
+
+// IsClosed reports whether month (YYYY-MM) is closed.
+func IsClosed(db Querier, month string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(1) FROM closed_periods WHERE month = ? AND reopened_at IS NULL`, month+"-01").Scan(&n)
+	return n > 0, err
+}
+
+// CheckOpen returns a *ClosedError when any of dates (YYYY-MM-DD, or longer
+// timestamps) falls in a closed month.
+func CheckOpen(db Querier, dates ...string) error {
+	for _, d := range dates {
+		if len(d) < 7 {
+			return errors.New("invalid date " + d)
+		}
+		closed, err := IsClosed(db, d[:7])
+		if err != nil {
+			return err
+		}
+		if closed {
+			return &ClosedError{Month: d[:7]}
+		}
+	}
+	return nil
+}
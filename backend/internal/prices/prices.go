@@ -0,0 +1,111 @@
+// Package prices compares a unit price with what was recently paid for the
+// same item, to catch typos and supplier overcharges as they are entered.
+package prices
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"almanarteen-backend/internal/money"
+)
+
+// Querier is satisfied by *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Policy says when a unit price counts as unusual.
+type Policy struct {
+	// Tolerance is the allowed deviation from the recent average, in
+	// percent. Zero disables the check.
+	Tolerance float64
+	// RequireConfirmation rejects unusual prices until the client resends
+	// them confirmed, instead of only flagging them.
+	RequireConfirmation bool
+	// WindowDays and Samples bound the history the average is taken over:
+	// the latest Samples purchases within WindowDays before the new one.
+	WindowDays int
+	Samples    int
+	// MinSamples is the history needed before anything is flagged.
+	MinSamples int
+}
+
+// PolicyFromEnv reads PRICE_TOLERANCE_PERCENT (default 30, 0 to disable)
+// and PRICE_REQUIRE_CONFIRM ("1" or "true").
+func PolicyFromEnv() Policy {
+	p := Policy{Tolerance: 30, WindowDays: 90, Samples: 20, MinSamples: 3}
+	if v, err := strconv.ParseFloat(os.Getenv("PRICE_TOLERANCE_PERCENT"), 64); err == nil && v >= 0 {
+		p.Tolerance = v
+	}
+	switch os.Getenv("PRICE_REQUIRE_CONFIRM") {
+	case "1", "true":
+		p.RequireConfirmation = true
+	}
+	return p
+}
+
+// Anomaly describes a unit price outside the tolerance.
+type Anomaly struct {
+	UnitPrice money.Fils `json:"unitPrice"`
+	Average   money.Fils `json:"average"`   // quantity-weighted
+	Deviation float64    `json:"deviation"` // percent; negative when cheaper
+	Tolerance float64    `json:"tolerance"`
+	Samples   int        `json:"samples"`
+}
+
+func (a Anomaly) String() string {
+	dir := "above"
+	if a.Deviation < 0 {
+		dir = "below"
+	}
+	return fmt.Sprintf("unit price %s BD is %.0f%% %s the recent average of %s BD",
+		a.UnitPrice, math.Abs(a.Deviation), dir, a.Average)
+}
+
+// Check compares price with the recent purchases of itemID up to date
+// (YYYY-MM-DD) and returns a non-nil Anomaly when it deviates by more than
+// the tolerance.
+func (p Policy) Check(db Querier, itemID, date string, price money.Fils) (*Anomaly, error) {
+	if p.Tolerance <= 0 {
+		return nil, nil
+	}
+
+	var n int
+	var weighted, qty sql.NullFloat64
+	err := db.QueryRow(`
+		SELECT COUNT(1), SUM(unit_price_fils * quantity), SUM(quantity)
+		FROM (
+			SELECT unit_price_fils, quantity
+			FROM expenses
+			WHERE item_id = ?
+				AND substr(purchase_date, 1, 10) BETWEEN date(?, ?) AND ?
+			ORDER BY purchase_date DESC, created_at DESC
+			LIMIT ?
+		)
+	`, itemID, date, fmt.Sprintf("-%d days", p.WindowDays), date, p.Samples).Scan(&n, &weighted, &qty)
+	if err != nil {
+		return nil, err
+	}
+	if n < p.MinSamples || qty.Float64 <= 0 {
+		return nil, nil
+	}
+
+	avg := money.Fils(math.Round(weighted.Float64 / qty.Float64))
+	if avg <= 0 {
+		return nil, nil
+	}
+	dev := float64(price-avg) * 100 / float64(avg)
+	if math.Abs(dev) <= p.Tolerance {
+		return nil, nil
+	}
+	return &Anomaly{
+		UnitPrice: price,
+		Average:   avg,
+		Deviation: math.Round(dev*10) / 10,
+		Tolerance: p.Tolerance,
+		Samples:   n,
+	}, nil
+}
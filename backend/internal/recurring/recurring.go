@@ -0,0 +1,371 @@
+// Package recurring turns expense templates (rent, gas cylinders, cleaning
+// contracts) into expenses as their dates come due. Each template records
+// at most one expense per date, enforced by a unique index, so the scheduler
+// can run any number of times without duplicating entries.
+package recurring
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"almanarteen-backend/internal/alerts"
+	"almanarteen-backend/internal/audit"
+	"almanarteen-backend/internal/db"
+	"almanarteen-backend/internal/ledger"
+	"almanarteen-backend/internal/money"
+	"almanarteen-backend/internal/periods"
+	"almanarteen-backend/internal/vat"
+)
+
+const (
+	Weekly  = "weekly"
+	Monthly = "monthly"
+)
+
+const dateLayout = "2006-01-02"
+
+// BackfillLimit is how many past occurrences a template may record at once
+// before the caller has to confirm them.
+const BackfillLimit = 31
+
+// Location is the business's time zone: a day starts at its midnight.
+var Location = time.UTC
+
+// Template is a recurring expense as stored in recurring_expenses.
+type Template struct {
+	ID           string       `json:"id"`
+	ItemID       string       `json:"itemId"`
+	Item         string       `json:"item"`
+	Quantity     float64      `json:"quantity"`
+	Unit         string       `json:"unit"` // empty for the item's unit
+	UnitPrice    money.Fils   `json:"unitPrice"`
+	Note         string       `json:"note"`
+	SupplierID   *string      `json:"supplierId"`
+	VATCategory  vat.Category `json:"vatCategory"`
+	VATInclusive bool         `json:"vatInclusive"`
+	Frequency    string       `json:"frequency"`
+	Weekday      *int         `json:"weekday"`    // weekly: 0 = Sunday
+	DayOfMonth   *int         `json:"dayOfMonth"` // monthly
+	StartDate    string       `json:"startDate"`
+	EndDate      *string      `json:"endDate"`
+	DoneThrough  *string      `json:"doneThrough"`
+	Paused       bool         `json:"paused"`
+	CreatedBy    string       `json:"createdBy"`
+}
+
+// Schedule returns when t falls due.
+func (t Template) Schedule() (Schedule, error) {
+	s := Schedule{Frequency: t.Frequency}
+	if t.Weekday != nil {
+		s.Weekday = time.Weekday(*t.Weekday)
+	}
+	if t.DayOfMonth != nil {
+		s.DayOfMonth = *t.DayOfMonth
+	}
+	var err error
+	if s.Start, err = time.Parse(dateLayout, t.StartDate); err != nil {
+		return s, errors.New("startDate must be YYYY-MM-DD")
+	}
+	if t.EndDate != nil && *t.EndDate != "" {
+		end, err := time.Parse(dateLayout, *t.EndDate)
+		if err != nil {
+			return s, errors.New("endDate must be YYYY-MM-DD")
+		}
+		s.End = &end
+	}
+	return s, s.Validate()
+}
+
+// pending is the first date that has not been recorded yet.
+func (t Template) pending(s Schedule) time.Time {
+	if t.DoneThrough != nil {
+		if d, err := time.Parse(dateLayout, *t.DoneThrough); err == nil && !d.Before(s.Start) {
+			return d.AddDate(0, 0, 1)
+		}
+	}
+	return s.Start
+}
+
+// Due returns how many occurrences up to today t has yet to record.
+func (t Template) Due(today time.Time) (int, error) {
+	s, err := t.Schedule()
+	if err != nil {
+		return 0, err
+	}
+	return len(s.Between(t.pending(s), today)), nil
+}
+
+// Upcoming returns the next n dates t will record an expense on.
+func (t Template) Upcoming(n int) ([]string, error) {
+	s, err := t.Schedule()
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, d := range s.Upcoming(t.pending(s), n) {
+		out = append(out, d.Format(dateLayout))
+	}
+	return out, nil
+}
+
+// Schedule is a weekly or monthly repetition between Start and End
+// (inclusive; nil End repeats indefinitely). Dates are UTC midnights.
+type Schedule struct {
+	Frequency  string
+	Weekday    time.Weekday // weekly
+	DayOfMonth int          // monthly; past the end of a month means its last day
+	Start      time.Time
+	End        *time.Time
+}
+
+func (s Schedule) Validate() error {
+	switch s.Frequency {
+	case Weekly:
+		if s.Weekday < time.Sunday || s.Weekday > time.Saturday {
+			return errors.New("weekday must be 0 (Sunday) to 6 (Saturday)")
+		}
+	case Monthly:
+		if s.DayOfMonth < 1 || s.DayOfMonth > 31 {
+			return errors.New("dayOfMonth must be between 1 and 31")
+		}
+	default:
+		return errors.New("frequency must be weekly or monthly")
+	}
+	if s.End != nil && s.End.Before(s.Start) {
+		return errors.New("endDate must not be before startDate")
+	}
+	return nil
+}
+
+// Next returns the first occurrence on or after day, or false when the
+// schedule has ended by then.
+func (s Schedule) Next(day time.Time) (time.Time, bool) {
+	if day.Before(s.Start) {
+		day = s.Start
+	}
+
+	var next time.Time
+	switch s.Frequency {
+	case Weekly:
+		next = day.AddDate(0, 0, (int(s.Weekday)-int(day.Weekday())+7)%7)
+	case Monthly:
+		next = s.inMonth(day.Year(), day.Month())
+		if next.Before(day) {
+			next = s.inMonth(day.Year(), day.Month()+1)
+		}
+	default:
+		return time.Time{}, false
+	}
+
+	if s.End != nil && next.After(*s.End) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+func (s Schedule) inMonth(year int, month time.Month) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return time.Date(year, month, min(s.DayOfMonth, last), 0, 0, 0, 0, time.UTC)
+}
+
+// Between returns the occurrences from from to to, inclusive.
+func (s Schedule) Between(from, to time.Time) []time.Time {
+	var out []time.Time
+	for d, ok := s.Next(from); ok && !d.After(to); d, ok = s.Next(d.AddDate(0, 0, 1)) {
+		out = append(out, d)
+	}
+	return out
+}
+
+// Upcoming returns the next n occurrences from from on.
+func (s Schedule) Upcoming(from time.Time, n int) []time.Time {
+	out := []time.Time{}
+	for d, ok := s.Next(from); ok && len(out) < n; d, ok = s.Next(d.AddDate(0, 0, 1)) {
+		out = append(out, d)
+	}
+	return out
+}
+
+// Today is the current date in Location, as a UTC midnight.
+func Today() time.Time {
+	y, m, d := time.Now().In(Location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+const templateSelect = `
+	SELECT r.id, r.item_id, i.name, r.quantity, r.unit, r.unit_price_fils, r.note, r.supplier_id,
+		r.vat_category, r.vat_inclusive, r.frequency, r.weekday, r.day_of_month,
+		substr(r.start_date, 1, 10), substr(r.end_date, 1, 10), substr(r.done_through, 1, 10),
+		r.paused_at IS NOT NULL, r.created_by
+	FROM recurring_expenses r
+	JOIN items i ON i.id = r.item_id
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTemplate(s rowScanner) (Template, error) {
+	var t Template
+	err := s.Scan(&t.ID, &t.ItemID, &t.Item, &t.Quantity, &t.Unit, &t.UnitPrice, &t.Note, &t.SupplierID,
+		&t.VATCategory, &t.VATInclusive, &t.Frequency, &t.Weekday, &t.DayOfMonth,
+		&t.StartDate, &t.EndDate, &t.DoneThrough, &t.Paused, &t.CreatedBy)
+	return t, err
+}
+
+// Get loads one template; sql.ErrNoRows when there is none.
+func Get(conn *sql.DB, id string) (Template, error) {
+	return scanTemplate(conn.QueryRow(templateSelect+` WHERE r.id = ?`, id))
+}
+
+// List loads every template, active ones first.
+func List(conn *sql.DB) ([]Template, error) {
+	rows, err := conn.Query(templateSelect + ` ORDER BY r.paused_at IS NOT NULL, i.name, r.created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// Scheduler records the expenses of templates as they fall due.
+type Scheduler struct {
+	DB     *sql.DB
+	Alerts *alerts.Evaluator // may be nil
+}
+
+// Run records due expenses now and then every interval. It blocks; start it
+// with go.
+func (s *Scheduler) Run(every time.Duration) {
+	for {
+		if n, err := s.RunDue(Today()); err != nil {
+			log.Println("recurring:", err)
+		} else if n > 0 {
+			log.Printf("recurring: recorded %d expenses", n)
+		}
+		time.Sleep(every)
+	}
+}
+
+// RunDue records the occurrences up to today of every active template and
+// returns how many expenses it created. A template that fails is logged and
+// retried next time; the others still run.
+func (s *Scheduler) RunDue(today time.Time) (int, error) {
+	rows, err := s.DB.Query(`SELECT id FROM recurring_expenses WHERE paused_at IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	total := 0
+	for _, id := range ids {
+		n, err := s.Materialize(id, today)
+		if err != nil {
+			log.Printf("recurring: template %s: %v", id, err)
+			continue
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Materialize records the pending occurrences of one template up to today.
+// Dates that already have an expense from the template are skipped.
+func (s *Scheduler) Materialize(id string, today time.Time) (int, error) {
+	t, err := Get(s.DB, id)
+	if err != nil {
+		return 0, err
+	}
+	if t.Paused {
+		return 0, nil
+	}
+	sched, err := t.Schedule()
+	if err != nil {
+		return 0, err
+	}
+
+	from := t.pending(sched)
+	if from.After(today) {
+		return 0, nil
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	supplierID := ""
+	if t.SupplierID != nil {
+		supplierID = *t.SupplierID
+	}
+
+	var created []string
+	for _, d := range sched.Between(from, today) {
+		date := d.Format(dateLayout)
+		id, _, err := ledger.Insert(tx, ledger.Expense{
+			Date:         date,
+			ItemID:       t.ItemID,
+			Quantity:     t.Quantity,
+			Unit:         t.Unit,
+			UnitPrice:    t.UnitPrice,
+			Note:         t.Note,
+			SupplierID:   supplierID,
+			VATCategory:  t.VATCategory,
+			VATInclusive: t.VATInclusive,
+			CreatedBy:    t.CreatedBy,
+			RecurringID:  t.ID,
+		})
+		if db.IsUniqueViolation(err) {
+			continue // already recorded
+		}
+		var closed *periods.ClosedError
+		if errors.As(err, &closed) {
+			continue // the month was closed without it
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", date, err)
+		}
+		if err := audit.Inserted("expenses", "id = ?", id).Record(tx, audit.Actor{}, audit.Create); err != nil {
+			return 0, err
+		}
+		created = append(created, date)
+	}
+
+	if _, err := tx.Exec(`UPDATE recurring_expenses SET done_through = ? WHERE id = ?`, today.Format(dateLayout), t.ID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	months := map[string]bool{}
+	for _, d := range created {
+		if !months[d[:7]] {
+			months[d[:7]] = true
+			s.Alerts.ForExpense(d, t.ItemID)
+		}
+	}
+	return len(created), nil
+}
@@ -0,0 +1,119 @@
+package recurring
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	d, err := time.Parse(dateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func dates(ts []time.Time) []string {
+	out := []string{}
+	for _, t := range ts {
+		out = append(out, t.Format(dateLayout))
+	}
+	return out
+}
+
+func TestScheduleNext(t *testing.T) {
+	end := day("2026-06-30")
+	tests := []struct {
+		name string
+		s    Schedule
+		from string
+		want string // empty when the schedule has ended
+	}{
+		{"weekly same day", Schedule{Frequency: Weekly, Weekday: time.Friday, Start: day("2026-01-01")}, "2026-01-02", "2026-01-02"},
+		{"weekly later in week", Schedule{Frequency: Weekly, Weekday: time.Sunday, Start: day("2026-01-01")}, "2026-01-05", "2026-01-11"},
+		{"weekly before start", Schedule{Frequency: Weekly, Weekday: time.Monday, Start: day("2026-03-01")}, "2026-01-01", "2026-03-02"},
+		{"monthly this month", Schedule{Frequency: Monthly, DayOfMonth: 15, Start: day("2026-01-01")}, "2026-01-10", "2026-01-15"},
+		{"monthly next month", Schedule{Frequency: Monthly, DayOfMonth: 15, Start: day("2026-01-01")}, "2026-01-16", "2026-02-15"},
+		{"monthly 31st in February", Schedule{Frequency: Monthly, DayOfMonth: 31, Start: day("2026-01-01")}, "2026-02-01", "2026-02-28"},
+		{"monthly 31st in leap February", Schedule{Frequency: Monthly, DayOfMonth: 31, Start: day("2028-01-01")}, "2028-02-01", "2028-02-29"},
+		{"monthly 30th in April", Schedule{Frequency: Monthly, DayOfMonth: 30, Start: day("2026-01-01")}, "2026-04-01", "2026-04-30"},
+		{"monthly across the year", Schedule{Frequency: Monthly, DayOfMonth: 5, Start: day("2026-01-01")}, "2026-12-06", "2027-01-05"},
+		{"on the end date", Schedule{Frequency: Monthly, DayOfMonth: 30, Start: day("2026-01-01"), End: &end}, "2026-06-01", "2026-06-30"},
+		{"past the end date", Schedule{Frequency: Monthly, DayOfMonth: 1, Start: day("2026-01-01"), End: &end}, "2026-06-02", ""},
+	}
+	for _, tt := range tests {
+		got, ok := tt.s.Next(day(tt.from))
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%s: Next(%s) = %s; want none", tt.name, tt.from, got.Format(dateLayout))
+			}
+			continue
+		}
+		if !ok || got.Format(dateLayout) != tt.want {
+			t.Errorf("%s: Next(%s) = %s, %v; want %s", tt.name, tt.from, got.Format(dateLayout), ok, tt.want)
+		}
+	}
+}
+
+func TestScheduleBetween(t *testing.T) {
+	end := day("2026-05-31")
+	tests := []struct {
+		name     string
+		s        Schedule
+		from, to string
+		want     []string
+	}{
+		{
+			"month ends", Schedule{Frequency: Monthly, DayOfMonth: 31, Start: day("2026-01-01")},
+			"2026-01-01", "2026-05-01",
+			[]string{"2026-01-31", "2026-02-28", "2026-03-31", "2026-04-30"},
+		},
+		{
+			"end date", Schedule{Frequency: Monthly, DayOfMonth: 31, Start: day("2026-01-01"), End: &end},
+			"2026-04-01", "2026-12-31",
+			[]string{"2026-04-30", "2026-05-31"},
+		},
+		{
+			"weekly, bounds inclusive", Schedule{Frequency: Weekly, Weekday: time.Thursday, Start: day("2026-01-01")},
+			"2026-01-01", "2026-01-22",
+			[]string{"2026-01-01", "2026-01-08", "2026-01-15", "2026-01-22"},
+		},
+		{
+			"nothing due", Schedule{Frequency: Monthly, DayOfMonth: 20, Start: day("2026-01-01")},
+			"2026-01-21", "2026-02-19",
+			[]string{},
+		},
+	}
+	for _, tt := range tests {
+		got := dates(tt.s.Between(day(tt.from), day(tt.to)))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Between(%s, %s) = %v; want %v", tt.name, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateDue(t *testing.T) {
+	dom := 31
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name        string
+		start       string
+		doneThrough *string
+		today       string
+		want        int
+	}{
+		{"never run", "2026-01-01", nil, "2026-04-30", 4},
+		{"done through a clamped date", "2026-01-01", str("2026-02-28"), "2026-04-30", 2},
+		{"done through today", "2026-01-01", str("2026-04-30"), "2026-04-30", 0},
+		{"done through before start", "2026-03-01", str("2026-01-31"), "2026-04-30", 2},
+		{"start in the future", "2026-06-01", nil, "2026-04-30", 0},
+	}
+	for _, tt := range tests {
+		tmpl := Template{Frequency: Monthly, DayOfMonth: &dom, StartDate: tt.start, DoneThrough: tt.doneThrough}
+		got, err := tmpl.Due(day(tt.today))
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Due(%s) = %d, %v; want %d", tt.name, tt.today, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of RFC 6238 Appendix B, "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists 8-digit codes; 6-digit codes are their last six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		got, err := Code(rfcSecret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.code {
+			t.Errorf("Code at %d = %s; want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestCodeAcceptsLowerCaseSecret(t *testing.T) {
+	got, err := Code(strings.ToLower(rfcSecret), time.Unix(59, 0))
+	if err != nil || got != "287082" {
+		t.Errorf("Code with lower-case secret = %s, %v", got, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	for _, d := range []int64{-Skew, 0, Skew} {
+		code, _ := CodeAt(rfcSecret, step+d)
+		got, ok := Validate(rfcSecret, code, now)
+		if !ok || got != step+d {
+			t.Errorf("code of step %+d: Validate = %d, %v; want %d, true", d, got, ok, step+d)
+		}
+	}
+
+	for _, d := range []int64{-Skew - 1, Skew + 1} {
+		code, _ := CodeAt(rfcSecret, step+d)
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("code of step %+d accepted outside the skew", d)
+		}
+	}
+
+	code, _ := Code(rfcSecret, now)
+	if _, ok := Validate(rfcSecret, " "+code+" ", now); !ok {
+		t.Error("surrounding spaces should be ignored")
+	}
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(rfcSecret, bad, now); ok {
+			t.Errorf("Validate(%q) accepted", bad)
+		}
+	}
+	if _, ok := Validate("not base32!", code, now); ok {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, b := GenerateSecret(), GenerateSecret()
+	if a == b {
+		t.Error("two secrets are equal")
+	}
+	if len(a) != 32 {
+		t.Errorf("secret %q has %d characters; want 32 (160 bits)", a, len(a))
+	}
+	if _, err := Code(a, time.Now()); err != nil {
+		t.Errorf("generated secret does not decode: %v", err)
+	}
+}
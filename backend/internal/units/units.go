@@ -0,0 +1,118 @@
+// Package units converts quantities between units of measure. Items keep
+// their own unit; a quantity entered in a standard unit (kg, g, liter, ...)
+// or in one of the item's packs is converted to it.
+package units
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Querier is satisfied by *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+var (
+	ErrUnknownItem = errors.New("unknown item")
+	ErrUnknownUnit = errors.New("unknown unit")
+	ErrPackCycle   = errors.New("pack is defined in terms of itself")
+)
+
+// IncompatibleError reports units that cannot be converted into each other,
+// such as kg into liter.
+type IncompatibleError struct {
+	From, To string
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("%s cannot be converted to %s", e.From, e.To)
+}
+
+// maxPackDepth bounds packs defined in terms of other packs.
+const maxPackDepth = 4
+
+// amount is a quantity of base units in a dimension. The "item" dimension
+// stands for an item unit that is not a standard unit, such as "pack".
+type amount struct {
+	dimension string
+	base      float64
+}
+
+// Factor returns how many of the item's units one unit holds, so that a
+// quantity entered in unit is quantity*Factor in the item's unit. An empty
+// unit means the item's unit.
+func Factor(db Querier, itemID, unit string) (float64, error) {
+	var itemUnit string
+	err := db.QueryRow(`SELECT unit FROM items WHERE id = ?`, itemID).Scan(&itemUnit)
+	if err == sql.ErrNoRows {
+		return 0, ErrUnknownItem
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	unit = strings.TrimSpace(unit)
+	if unit == "" || strings.EqualFold(unit, itemUnit) {
+		return 1, nil
+	}
+
+	from, err := resolve(db, itemID, itemUnit, unit, 0)
+	if err != nil {
+		return 0, err
+	}
+	to, err := resolve(db, itemID, itemUnit, itemUnit, 0)
+	if err != nil {
+		return 0, err
+	}
+	if from.dimension != to.dimension {
+		return 0, &IncompatibleError{From: unit, To: itemUnit}
+	}
+	return from.base / to.base, nil
+}
+
+// resolve expresses one unit as an amount. Packs of the item come first,
+// then standard units, then the item's own unit.
+func resolve(db Querier, itemID, itemUnit, unit string, depth int) (amount, error) {
+	if depth > maxPackDepth {
+		return amount{}, fmt.Errorf("%w: %q", ErrPackCycle, unit)
+	}
+
+	var qty float64
+	var packUnit string
+	err := db.QueryRow(`SELECT quantity, unit FROM item_packs WHERE item_id = ? AND name = ?`, itemID, unit).Scan(&qty, &packUnit)
+	if err == nil {
+		a, err := resolve(db, itemID, itemUnit, packUnit, depth+1)
+		if err != nil {
+			return amount{}, err
+		}
+		a.base *= qty
+		return a, nil
+	}
+	if err != sql.ErrNoRows {
+		return amount{}, err
+	}
+
+	var a amount
+	err = db.QueryRow(`SELECT dimension, factor FROM units WHERE code = ?`, unit).Scan(&a.dimension, &a.base)
+	if err == nil {
+		return a, nil
+	}
+	if err != sql.ErrNoRows {
+		return amount{}, err
+	}
+
+	if strings.EqualFold(unit, itemUnit) {
+		return amount{dimension: "item", base: 1}, nil
+	}
+	return amount{}, fmt.Errorf("%w %q", ErrUnknownUnit, unit)
+}
+
+// IsStandard reports whether code is in the units table.
+func IsStandard(db Querier, code string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(1) FROM units WHERE code = ?`, code).Scan(&n)
+	return n > 0, err
+}
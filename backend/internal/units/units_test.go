@@ -0,0 +1,85 @@
+package units
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"almanarteen-backend/internal/db"
+)
+
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.ApplyMigrations(conn, "../../migrations"); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func exec(t *testing.T, conn *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := conn.Exec(query, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFactor(t *testing.T) {
+	conn := testDB(t)
+	exec(t, conn, `INSERT INTO categories (id, name) VALUES ('c', 'Kitchen')`)
+	exec(t, conn, `INSERT INTO items (id, category_id, name, unit) VALUES
+		('oil', 'c', 'Cooking oil', 'liter'),
+		('sugar', 'c', 'Sugar', 'kg'),
+		('napkins', 'c', 'Napkins', 'pack')`)
+	exec(t, conn, `INSERT INTO item_packs (id, item_id, name, quantity, unit) VALUES
+		('p1', 'oil', 'tin', 18, 'liter'),
+		('p2', 'oil', 'case', 4, 'TIN'),
+		('p3', 'oil', 'loop-a', 2, 'loop-b'),
+		('p4', 'oil', 'loop-b', 2, 'loop-a'),
+		('p5', 'napkins', 'carton', 12, 'pack')`)
+
+	var incompatible *IncompatibleError
+	tests := []struct {
+		item, unit string
+		want       float64
+		err        any // nil, a sentinel error or an error type pointer
+	}{
+		{"oil", "", 1, nil},
+		{"oil", "Liter", 1, nil},
+		{"oil", "l", 1, nil},
+		{"oil", "ml", 0.001, nil},
+		{"oil", "tin", 18, nil},
+		{"oil", "case", 72, nil}, // a pack of packs
+		{"sugar", "g", 0.001, nil},
+		{"sugar", "dozen", 0, &incompatible},
+		{"napkins", "carton", 12, nil},
+		{"napkins", "pcs", 0, &incompatible}, // "pack" is no standard unit
+		{"oil", "kg", 0, &incompatible},
+		{"oil", "loop-a", 0, ErrPackCycle},
+		{"oil", "cup", 0, ErrUnknownUnit},
+		{"missing", "kg", 0, ErrUnknownItem},
+	}
+	for _, tt := range tests {
+		got, err := Factor(conn, tt.item, tt.unit)
+		switch want := tt.err.(type) {
+		case nil:
+			if err != nil || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Factor(%s, %q) = %v, %v; want %v", tt.item, tt.unit, got, err, tt.want)
+			}
+		case error:
+			if !errors.Is(err, want) {
+				t.Errorf("Factor(%s, %q) error = %v; want %v", tt.item, tt.unit, err, want)
+			}
+		default:
+			if !errors.As(err, want) {
+				t.Errorf("Factor(%s, %q) error = %v; want %T", tt.item, tt.unit, err, want)
+			}
+		}
+	}
+}
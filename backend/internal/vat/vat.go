@@ -0,0 +1,56 @@
+// Package vat splits expense amounts into net, VAT and gross under Bahrain's
+// VAT categories.
+package vat
+
+import (
+	"errors"
+
+	"almanarteen-backend/internal/money"
+)
+
+// Category is how a supply is treated for VAT.
+type Category string
+
+const (
+	Standard Category = "standard" // taxed at StandardRate; input VAT is reclaimable
+	Zero     Category = "zero"     // zero-rated: taxable at 0%
+	Exempt   Category = "exempt"   // outside VAT, e.g. most rent and financial services
+)
+
+// StandardRate is Bahrain's standard rate in basis points (10%, since
+// January 2022).
+const StandardRate = 1000
+
+var ErrInvalidCategory = errors.New("vatCategory must be standard, zero or exempt")
+
+// Valid reports whether c is a known category.
+func (c Category) Valid() bool {
+	return c == Standard || c == Zero || c == Exempt
+}
+
+// Rate returns the rate in basis points applied to new expenses in c.
+func (c Category) Rate() int64 {
+	if c == Standard {
+		return StandardRate
+	}
+	return 0
+}
+
+// Split breaks amount into net, VAT and gross at rate basis points. When
+// inclusive, amount is the gross and the VAT is carved out of it; otherwise
+// amount is the net and VAT is added on top. VAT is rounded half up to the
+// nearest fils.
+func Split(amount money.Fils, rate int64, inclusive bool) (net, tax, gross money.Fils) {
+	a := int64(amount)
+	if inclusive {
+		t := divRound(a*rate, 10000+rate)
+		return money.Fils(a - t), money.Fils(t), amount
+	}
+	t := divRound(a*rate, 10000)
+	return amount, money.Fils(t), money.Fils(a + t)
+}
+
+// divRound divides non-negative a by b, rounding half up.
+func divRound(a, b int64) int64 {
+	return (2*a + b) / (2 * b)
+}
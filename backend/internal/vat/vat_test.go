@@ -0,0 +1,41 @@
+package vat
+
+import (
+	"testing"
+
+	"almanarteen-backend/internal/money"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		amount          money.Fils
+		rate            int64
+		inclusive       bool
+		net, tax, gross money.Fils
+	}{
+		{1000, StandardRate, false, 1000, 100, 1100},
+		{1235, StandardRate, false, 1235, 124, 1359}, // 123.5 rounds up
+		{15, StandardRate, false, 15, 2, 17},         // 1.5 rounds up
+		{5, StandardRate, false, 5, 1, 6},            // 0.5 rounds up
+		{4, StandardRate, false, 4, 0, 4},            // 0.4 rounds down
+		{0, StandardRate, false, 0, 0, 0},
+
+		{1100, StandardRate, true, 1000, 100, 1100},
+		{1359, StandardRate, true, 1235, 124, 1359}, // 123.545 rounds up
+		{11, StandardRate, true, 10, 1, 11},
+		{6, StandardRate, true, 5, 1, 6}, // 0.545 rounds up
+		{1, StandardRate, true, 1, 0, 1}, // 0.091 rounds down
+
+		{1234, 0, false, 1234, 0, 1234},
+		{1234, 0, true, 1234, 0, 1234},
+		{1000, 500, false, 1000, 50, 1050},
+		{1050, 500, true, 1000, 50, 1050},
+	}
+	for _, tt := range tests {
+		net, tax, gross := Split(tt.amount, tt.rate, tt.inclusive)
+		if net != tt.net || tax != tt.tax || gross != tt.gross {
+			t.Errorf("Split(%d, %d, %v) = %d, %d, %d; want %d, %d, %d",
+				tt.amount, tt.rate, tt.inclusive, net, tax, gross, tt.net, tt.tax, tt.gross)
+		}
+	}
+}
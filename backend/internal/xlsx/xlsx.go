@@ -0,0 +1,207 @@
+// Package xlsx writes simple Office Open XML spreadsheets row by row, so
+// large exports stream straight to the client instead of being built in
+// memory. It supports several sheets of strings, numbers and dates, and
+// nothing else: no formulas, merged cells or shared strings.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cell values other than these types are written with fmt.Sprint as text.
+type (
+	// Bold is text in bold, for header and total rows.
+	Bold string
+	// Amount is a number shown with three decimals (dinars and fils).
+	Amount float64
+)
+
+// Style indexes into the cellXfs of styles.xml below.
+const (
+	styleDefault = 0
+	styleBold    = 1
+	styleAmount  = 2
+	styleDate    = 3
+)
+
+// Writer streams a workbook into a zip archive. Sheets must be written one
+// after another: NewSheet ends the previous sheet.
+type Writer struct {
+	zw     *zip.Writer
+	sheets []string
+	sheet  io.Writer // current sheet part, nil before the first NewSheet
+	row    int
+	err    error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zw: zip.NewWriter(w)}
+}
+
+// NewSheet starts a sheet called name (at most 31 characters, as in Excel).
+func (w *Writer) NewSheet(name string) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.endSheet()
+	w.sheets = append(w.sheets, name)
+	w.sheet, w.err = w.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheets)))
+	w.row = 0
+	w.write(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return w.err
+}
+
+// WriteRow appends a row to the current sheet. A nil cell is left empty.
+func (w *Writer) WriteRow(cells ...any) error {
+	if w.err == nil && w.sheet == nil {
+		w.err = fmt.Errorf("xlsx: WriteRow before NewSheet")
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.row++
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, w.row)
+	for i, c := range cells {
+		ref := colName(i) + strconv.Itoa(w.row)
+		switch v := c.(type) {
+		case nil:
+		case Bold:
+			inlineStr(&b, ref, string(v), styleBold)
+		case string:
+			inlineStr(&b, ref, v, styleDefault)
+		case Amount:
+			fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleAmount, strconv.FormatFloat(float64(v), 'f', -1, 64))
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case int:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case int64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case time.Time:
+			fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleDate, strconv.FormatFloat(serial(v), 'f', -1, 64))
+		default:
+			inlineStr(&b, ref, fmt.Sprint(v), styleDefault)
+		}
+	}
+	b.WriteString(`</row>`)
+
+	w.write(b.String())
+	return w.err
+}
+
+// Close finishes the last sheet and writes the workbook parts.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.endSheet()
+
+	var sheets, rels, types strings.Builder
+	for i, name := range w.sheets {
+		n := i + 1
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+	}
+	stylesRel := len(w.sheets) + 1
+
+	w.part("[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`+
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`+
+		`<Default Extension="xml" ContentType="application/xml"/>`+
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`+
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`+
+		types.String()+`</Types>`)
+	w.part("_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>`+
+		`</Relationships>`)
+	w.part("xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" `+
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`+
+		sheets.String()+`</sheets></workbook>`)
+	w.part("xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+
+		rels.String()+
+		fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, stylesRel)+
+		`</Relationships>`)
+	w.part("xl/styles.xml", styles)
+
+	if w.err != nil {
+		return w.err
+	}
+	return w.zw.Close()
+}
+
+func (w *Writer) endSheet() {
+	if w.sheet != nil {
+		w.write(`</sheetData></worksheet>`)
+		w.sheet = nil
+	}
+}
+
+func (w *Writer) part(name, body string) {
+	if w.err != nil {
+		return
+	}
+	var f io.Writer
+	f, w.err = w.zw.Create(name)
+	if w.err == nil {
+		_, w.err = io.WriteString(f, xml.Header+body)
+	}
+}
+
+func (w *Writer) write(s string) {
+	if w.err == nil {
+		_, w.err = io.WriteString(w.sheet, s)
+	}
+}
+
+// styles defines the cellXfs referenced by the style constants: default,
+// bold, three-decimal number and ISO date.
+const styles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="2"><numFmt numFmtId="164" formatCode="0.000"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs></styleSheet>`
+
+func inlineStr(b *strings.Builder, ref, s string, style int) {
+	fmt.Fprintf(b, `<c r="%s" t="inlineStr"`, ref)
+	if style != styleDefault {
+		fmt.Fprintf(b, ` s="%d"`, style)
+	}
+	fmt.Fprintf(b, `><is><t xml:space="preserve">%s</t></is></c>`, escape(s))
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// colName turns a zero-based column index into its letters: 0 is A, 26 is AA.
+func colName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// serial converts t to an Excel date serial number (days since 1899-12-30).
+func serial(t time.Time) float64 {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(epoch).Hours() / 24
+}
@@ -0,0 +1,22 @@
+PRAGMA foreign_keys = ON;
+
+ALTER TABLE categories ADD COLUMN archived_at DATETIME;
+
+-- Rebuild items so deleting a category no longer cascades into items
+-- (and, through them, orphans expenses). archived_at is added on the way.
+CREATE TABLE items_new (
+  id TEXT PRIMARY KEY,
+  category_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  unit TEXT NOT NULL,
+  archived_at DATETIME,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE RESTRICT,
+  UNIQUE(category_id, name)
+);
+
+INSERT INTO items_new (id, category_id, name, unit, created_at)
+SELECT id, category_id, name, unit, created_at FROM items;
+
+DROP TABLE items;
+ALTER TABLE items_new RENAME TO items;
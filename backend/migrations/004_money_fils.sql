@@ -0,0 +1,44 @@
+PRAGMA foreign_keys = ON;
+
+-- Money moves from REAL dinars to INTEGER fils (1 BD = 1000 fils) so that
+-- three-decimal amounts are stored exactly and sums no longer drift.
+
+CREATE TABLE expenses_new (
+  id TEXT PRIMARY KEY,
+  item_id TEXT NOT NULL,
+  quantity REAL NOT NULL CHECK (quantity > 0),
+  unit_price_fils INTEGER NOT NULL CHECK (unit_price_fils >= 0),
+  total_price_fils INTEGER NOT NULL CHECK (total_price_fils >= 0),
+  purchase_date DATE NOT NULL,
+  note TEXT,
+  created_by TEXT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (item_id) REFERENCES items(id),
+  FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+INSERT INTO expenses_new (id, item_id, quantity, unit_price_fils, total_price_fils, purchase_date, note, created_by, created_at)
+SELECT id, item_id, quantity,
+       CAST(ROUND(unit_price * 1000) AS INTEGER),
+       CAST(ROUND(total_price * 1000) AS INTEGER),
+       purchase_date, note, created_by, created_at
+FROM expenses;
+
+DROP TABLE expenses;
+ALTER TABLE expenses_new RENAME TO expenses;
+
+CREATE TABLE monthly_budgets_new (
+  id TEXT PRIMARY KEY,
+  month DATE NOT NULL UNIQUE,           -- store first day of month (e.g., 2026-01-01)
+  max_budget_fils INTEGER NOT NULL CHECK(max_budget_fils >= 0),
+  created_by TEXT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+INSERT INTO monthly_budgets_new (id, month, max_budget_fils, created_by, created_at)
+SELECT id, month, CAST(ROUND(max_budget * 1000) AS INTEGER), created_by, created_at
+FROM monthly_budgets;
+
+DROP TABLE monthly_budgets;
+ALTER TABLE monthly_budgets_new RENAME TO monthly_budgets;
@@ -0,0 +1,17 @@
+PRAGMA foreign_keys = ON;
+
+-- Relax the role CHECK from admin-only to the roles known to auth.Roles.
+CREATE TABLE users_new (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL UNIQUE,
+  password_hash TEXT NOT NULL,
+  role TEXT NOT NULL CHECK (role IN ('admin', 'manager', 'purchaser', 'viewer')),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO users_new (id, name, email, password_hash, role, created_at)
+SELECT id, name, email, password_hash, role, created_at FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
@@ -0,0 +1,3 @@
+PRAGMA foreign_keys = ON;
+
+ALTER TABLE users ADD COLUMN disabled_at DATETIME;
@@ -0,0 +1,14 @@
+PRAGMA foreign_keys = ON;
+
+-- Every login attempt, keyed by the email as typed (normalized) so that
+-- throttling behaves the same whether or not the account exists.
+CREATE TABLE IF NOT EXISTS login_attempts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  email TEXT NOT NULL,
+  ip TEXT NOT NULL,
+  succeeded INTEGER NOT NULL,
+  attempted_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_email ON login_attempts(email, attempted_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip, attempted_at);
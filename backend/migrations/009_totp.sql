@@ -0,0 +1,33 @@
+PRAGMA foreign_keys = ON;
+
+-- TOTP second factor. A row without confirmed_at is an enrollment in progress.
+CREATE TABLE IF NOT EXISTS user_totp (
+  user_id TEXT PRIMARY KEY,
+  secret TEXT NOT NULL,                 -- base32, needed in clear to compute codes
+  confirmed_at DATETIME,
+  last_step INTEGER NOT NULL DEFAULT 0, -- last accepted time step, blocks code replay
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id TEXT PRIMARY KEY,
+  user_id TEXT NOT NULL,
+  code_hash TEXT NOT NULL,
+  used_at DATETIME,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id);
+
+-- Password checked, second factor pending. id is the hash of the token
+-- handed to the client between the two login steps.
+CREATE TABLE IF NOT EXISTS login_challenges (
+  id TEXT PRIMARY KEY,
+  user_id TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
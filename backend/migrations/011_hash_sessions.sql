@@ -0,0 +1,8 @@
+PRAGMA foreign_keys = ON;
+
+-- sessions.id now holds sha256(cookie token) instead of the token itself.
+-- Existing rows hold raw tokens that can't be hashed in SQL, so they are
+-- dropped and everyone signs in once more.
+DELETE FROM sessions;
+
+ALTER TABLE sessions ADD COLUMN csrf_token TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,17 @@
+PRAGMA foreign_keys = ON;
+
+CREATE TABLE IF NOT EXISTS suppliers (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+  cr_number TEXT NOT NULL DEFAULT '',      -- commercial registration
+  vat_number TEXT NOT NULL DEFAULT '',
+  phone TEXT NOT NULL DEFAULT '',
+  payment_terms TEXT NOT NULL DEFAULT '',  -- free text, e.g. "cash", "30 days"
+  archived_at DATETIME,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Optional; expenses recorded before suppliers existed keep NULL.
+ALTER TABLE expenses ADD COLUMN supplier_id TEXT REFERENCES suppliers(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS idx_expenses_supplier ON expenses(supplier_id);
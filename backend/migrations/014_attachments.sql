@@ -0,0 +1,19 @@
+PRAGMA foreign_keys = ON;
+
+-- Receipts and invoices attached to expenses. The file itself lives in the
+-- blob store under its SHA-256, so identical uploads share one blob.
+CREATE TABLE IF NOT EXISTS attachments (
+  id TEXT PRIMARY KEY,
+  expense_id TEXT NOT NULL,
+  filename TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size_bytes INTEGER NOT NULL,
+  sha256 TEXT NOT NULL,
+  uploaded_by TEXT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (expense_id) REFERENCES expenses(id) ON DELETE CASCADE,
+  FOREIGN KEY (uploaded_by) REFERENCES users(id),
+  UNIQUE(expense_id, sha256)
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_sha256 ON attachments(sha256);
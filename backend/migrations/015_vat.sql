@@ -0,0 +1,14 @@
+PRAGMA foreign_keys = ON;
+
+-- VAT treatment per expense. total_price_fils stays the gross amount paid;
+-- net_fils + vat_fils = total_price_fils. The rate is stored in basis points
+-- as it was when the expense was recorded, so a future rate change does not
+-- rewrite history. Existing expenses are treated as exempt.
+ALTER TABLE expenses ADD COLUMN vat_category TEXT NOT NULL DEFAULT 'exempt'
+  CHECK (vat_category IN ('standard', 'zero', 'exempt'));
+ALTER TABLE expenses ADD COLUMN vat_rate_bp INTEGER NOT NULL DEFAULT 0 CHECK (vat_rate_bp >= 0);
+ALTER TABLE expenses ADD COLUMN vat_inclusive INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE expenses ADD COLUMN net_fils INTEGER NOT NULL DEFAULT 0 CHECK (net_fils >= 0);
+ALTER TABLE expenses ADD COLUMN vat_fils INTEGER NOT NULL DEFAULT 0 CHECK (vat_fils >= 0);
+
+UPDATE expenses SET net_fils = total_price_fils;
@@ -0,0 +1,14 @@
+PRAGMA foreign_keys = ON;
+
+-- Optional caps per category and month, alongside the overall monthly_budgets.
+CREATE TABLE IF NOT EXISTS category_budgets (
+  id TEXT PRIMARY KEY,
+  month DATE NOT NULL,                  -- first day of the month, like monthly_budgets
+  category_id TEXT NOT NULL,
+  max_budget_fils INTEGER NOT NULL CHECK (max_budget_fils > 0),
+  created_by TEXT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE,
+  FOREIGN KEY (created_by) REFERENCES users(id),
+  UNIQUE(month, category_id)
+);
@@ -0,0 +1,28 @@
+PRAGMA foreign_keys = ON;
+
+-- Percentages of a budget at which an alert fires, e.g. 75, 90, 100.
+CREATE TABLE IF NOT EXISTS alert_thresholds (
+  percent INTEGER PRIMARY KEY CHECK (percent > 0 AND percent <= 1000),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO alert_thresholds (percent) VALUES (75), (90), (100);
+
+-- One row per threshold crossed, so each alert fires once. category_id is
+-- NULL for the overall monthly budget. Rows double as in-app notifications.
+CREATE TABLE IF NOT EXISTS budget_alerts (
+  id TEXT PRIMARY KEY,
+  month DATE NOT NULL,
+  category_id TEXT,
+  percent INTEGER NOT NULL,
+  spent_fils INTEGER NOT NULL,
+  budget_fils INTEGER NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  acknowledged_at DATETIME,
+  acknowledged_by TEXT,
+  FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE,
+  FOREIGN KEY (acknowledged_by) REFERENCES users(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budget_alerts_once
+  ON budget_alerts(month, COALESCE(category_id, ''), percent);
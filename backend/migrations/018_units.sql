@@ -0,0 +1,40 @@
+PRAGMA foreign_keys = ON;
+
+-- Standard units. factor is the number of base units (g, ml, pcs) in one of
+-- this unit; units convert into each other only within a dimension.
+CREATE TABLE IF NOT EXISTS units (
+  code TEXT PRIMARY KEY COLLATE NOCASE,
+  name TEXT NOT NULL,
+  dimension TEXT NOT NULL CHECK (dimension IN ('mass', 'volume', 'count')),
+  factor REAL NOT NULL CHECK (factor > 0)
+);
+
+INSERT OR IGNORE INTO units (code, name, dimension, factor) VALUES
+  ('g', 'gram', 'mass', 1),
+  ('kg', 'kilogram', 'mass', 1000),
+  ('ml', 'millilitre', 'volume', 1),
+  ('l', 'litre', 'volume', 1000),
+  ('liter', 'litre', 'volume', 1000),
+  ('pcs', 'piece', 'count', 1),
+  ('piece', 'piece', 'count', 1),
+  ('dozen', 'dozen', 'count', 12);
+
+-- Item-specific packaging: one <name> holds <quantity> <unit>, where unit is
+-- a standard unit, the item's own unit or another pack of the item, e.g.
+-- "tin" = 18 liter for cooking oil.
+CREATE TABLE IF NOT EXISTS item_packs (
+  id TEXT PRIMARY KEY,
+  item_id TEXT NOT NULL,
+  name TEXT NOT NULL COLLATE NOCASE,
+  quantity REAL NOT NULL CHECK (quantity > 0),
+  unit TEXT NOT NULL COLLATE NOCASE,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (item_id) REFERENCES items(id) ON DELETE CASCADE,
+  UNIQUE(item_id, name)
+);
+
+-- quantity and unit_price_fils are always in the item's unit. When an
+-- expense is entered in another unit, what was typed is kept alongside.
+ALTER TABLE expenses ADD COLUMN entered_quantity REAL;
+ALTER TABLE expenses ADD COLUMN entered_unit TEXT;
+ALTER TABLE expenses ADD COLUMN entered_unit_price_fils INTEGER;
@@ -0,0 +1,40 @@
+PRAGMA foreign_keys = ON;
+
+-- Templates for expenses that repeat, such as rent or gas cylinders. A
+-- weekly template falls on weekday (0 = Sunday); a monthly one on
+-- day_of_month, moved to the last day in shorter months.
+CREATE TABLE IF NOT EXISTS recurring_expenses (
+  id TEXT PRIMARY KEY,
+  item_id TEXT NOT NULL,
+  quantity REAL NOT NULL CHECK (quantity > 0),
+  unit TEXT NOT NULL DEFAULT '',
+  unit_price_fils INTEGER NOT NULL CHECK (unit_price_fils > 0),
+  note TEXT NOT NULL DEFAULT '',
+  supplier_id TEXT,
+  vat_category TEXT NOT NULL DEFAULT 'exempt'
+    CHECK (vat_category IN ('standard', 'zero', 'exempt')),
+  vat_inclusive INTEGER NOT NULL DEFAULT 0,
+  frequency TEXT NOT NULL CHECK (frequency IN ('weekly', 'monthly')),
+  weekday INTEGER CHECK (weekday BETWEEN 0 AND 6),
+  day_of_month INTEGER CHECK (day_of_month BETWEEN 1 AND 31),
+  start_date DATE NOT NULL,
+  end_date DATE,
+  -- Occurrences up to this date have been recorded (or skipped while
+  -- paused); the scheduler continues from the day after.
+  done_through DATE,
+  paused_at DATETIME,
+  created_by TEXT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (item_id) REFERENCES items(id),
+  FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+  FOREIGN KEY (created_by) REFERENCES users(id),
+  CHECK ((frequency = 'weekly' AND weekday IS NOT NULL) OR (frequency = 'monthly' AND day_of_month IS NOT NULL))
+);
+
+ALTER TABLE expenses ADD COLUMN recurring_id TEXT REFERENCES recurring_expenses(id) ON DELETE SET NULL;
+
+-- A template records at most one expense per date, so running the
+-- scheduler twice (or from two places) cannot duplicate an entry.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_expenses_recurring_once
+  ON expenses(recurring_id, purchase_date) WHERE recurring_id IS NOT NULL;
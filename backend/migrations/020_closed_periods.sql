@@ -0,0 +1,19 @@
+PRAGMA foreign_keys = ON;
+
+-- Months closed after reconciliation. Expenses dated in a closed month
+-- cannot be created, edited or deleted. Reopening keeps the row and records
+-- who reopened it and why; closing again adds a new row.
+CREATE TABLE IF NOT EXISTS closed_periods (
+  id TEXT PRIMARY KEY,
+  month DATE NOT NULL, -- first day of the month
+  closed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  closed_by TEXT NOT NULL,
+  reopened_at DATETIME,
+  reopened_by TEXT,
+  reopen_reason TEXT,
+  FOREIGN KEY (closed_by) REFERENCES users(id),
+  FOREIGN KEY (reopened_by) REFERENCES users(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_closed_periods_open
+  ON closed_periods(month) WHERE reopened_at IS NULL;
@@ -0,0 +1,34 @@
+PRAGMA foreign_keys = ON;
+
+-- Append-only record of every change to expenses, budgets, the catalog and
+-- users. before_json/after_json hold the row as it was and as it became
+-- (NULL on create and delete respectively). actor_id and ip are NULL for
+-- changes made by the server itself, such as recurring expenses.
+CREATE TABLE IF NOT EXISTS audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  at DATETIME NOT NULL,
+  actor_id TEXT,
+  ip TEXT,
+  action TEXT NOT NULL,
+  entity TEXT NOT NULL,
+  entity_id TEXT NOT NULL DEFAULT '',
+  before_json TEXT,
+  after_json TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity, entity_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id, at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_at ON audit_log(at);
+
+-- No actor_id foreign key on purpose: entries must outlive what they
+-- describe. The triggers keep the table append-only even for code that
+-- bypasses the API.
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+  SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
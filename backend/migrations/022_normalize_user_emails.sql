@@ -0,0 +1,20 @@
+PRAGMA foreign_keys = ON;
+
+-- Sign-in and lookups compare against auth.NormalizeEmail (trimmed, lower
+-- case), so stored addresses must be normalized too or mixed-case accounts
+-- cannot log in. Accounts that would end up with the same address must be
+-- merged by hand first; the migration refuses to run until they are.
+CREATE TEMP TABLE email_conflicts (email TEXT);
+
+CREATE TEMP TRIGGER email_conflicts_abort BEFORE INSERT ON email_conflicts
+BEGIN
+  SELECT RAISE(ABORT, 'several users share an email once normalized; resolve them before migrating');
+END;
+
+INSERT INTO email_conflicts (email)
+SELECT lower(trim(email)) FROM users GROUP BY lower(trim(email)) HAVING COUNT(1) > 1;
+
+DROP TRIGGER email_conflicts_abort;
+DROP TABLE email_conflicts;
+
+UPDATE users SET email = lower(trim(email)) WHERE email != lower(trim(email));
@@ -0,0 +1,59 @@
+PRAGMA foreign_keys = ON;
+
+-- The API checks closed_periods before writing, in the same transaction.
+-- These triggers hold the line for every other path, such as the CLIs or a
+-- check that was missed. The message is matched by periods.IsViolation.
+-- Updates only count when they change the expense itself: deleting a
+-- recurring template clears recurring_id on expenses in closed months too.
+CREATE TRIGGER IF NOT EXISTS expenses_closed_insert BEFORE INSERT ON expenses
+WHEN EXISTS (
+  SELECT 1 FROM closed_periods
+  WHERE month = substr(NEW.purchase_date, 1, 7) || '-01' AND reopened_at IS NULL
+)
+BEGIN
+  SELECT RAISE(ABORT, 'month is closed; expenses in it cannot be added, changed or deleted until it is reopened');
+END;
+
+CREATE TRIGGER IF NOT EXISTS expenses_closed_update
+BEFORE UPDATE OF purchase_date, item_id, quantity, unit_price_fils, total_price_fils,
+  net_fils, vat_fils, vat_category, vat_rate_bp, vat_inclusive, note, supplier_id,
+  entered_quantity, entered_unit, entered_unit_price_fils
+ON expenses
+WHEN EXISTS (
+  SELECT 1 FROM closed_periods
+  WHERE month IN (substr(OLD.purchase_date, 1, 7) || '-01', substr(NEW.purchase_date, 1, 7) || '-01')
+    AND reopened_at IS NULL
+)
+BEGIN
+  SELECT RAISE(ABORT, 'month is closed; expenses in it cannot be added, changed or deleted until it is reopened');
+END;
+
+CREATE TRIGGER IF NOT EXISTS expenses_closed_delete BEFORE DELETE ON expenses
+WHEN EXISTS (
+  SELECT 1 FROM closed_periods
+  WHERE month = substr(OLD.purchase_date, 1, 7) || '-01' AND reopened_at IS NULL
+)
+BEGIN
+  SELECT RAISE(ABORT, 'month is closed; expenses in it cannot be added, changed or deleted until it is reopened');
+END;
+
+-- Receipts belong to the closed books as much as the expense they support.
+CREATE TRIGGER IF NOT EXISTS attachments_closed_insert BEFORE INSERT ON attachments
+WHEN EXISTS (
+  SELECT 1 FROM expenses e
+  JOIN closed_periods p ON p.month = substr(e.purchase_date, 1, 7) || '-01' AND p.reopened_at IS NULL
+  WHERE e.id = NEW.expense_id
+)
+BEGIN
+  SELECT RAISE(ABORT, 'month is closed; expenses in it cannot be added, changed or deleted until it is reopened');
+END;
+
+CREATE TRIGGER IF NOT EXISTS attachments_closed_delete BEFORE DELETE ON attachments
+WHEN EXISTS (
+  SELECT 1 FROM expenses e
+  JOIN closed_periods p ON p.month = substr(e.purchase_date, 1, 7) || '-01' AND p.reopened_at IS NULL
+  WHERE e.id = OLD.expense_id
+)
+BEGIN
+  SELECT RAISE(ABORT, 'month is closed; expenses in it cannot be added, changed or deleted until it is reopened');
+END;
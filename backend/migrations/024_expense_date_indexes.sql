@@ -0,0 +1,6 @@
+PRAGMA foreign_keys = ON;
+
+-- Expense lists and exports filter by date, often with an item; the price
+-- history reads one item's expenses over a date range.
+CREATE INDEX IF NOT EXISTS idx_expenses_purchase_date ON expenses(purchase_date);
+CREATE INDEX IF NOT EXISTS idx_expenses_item_date ON expenses(item_id, purchase_date);
@@ -0,0 +1,7 @@
+PRAGMA foreign_keys = ON;
+
+-- Alerts fire once per threshold and budget amount: after a budget is
+-- raised, crossing a threshold of the new amount alerts again.
+DROP INDEX IF EXISTS idx_budget_alerts_once;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budget_alerts_once
+  ON budget_alerts(month, COALESCE(category_id, ''), percent, budget_fils);
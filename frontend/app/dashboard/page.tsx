@@ -22,7 +22,7 @@ function currentMonth() {
 }
 
 function fmtBD(x: number) {
-  return `${x.toFixed(2)} BD`;
+  return `${x.toFixed(3)} BD`;
 }
 
 function prevMonths(n: number) {
@@ -2,7 +2,7 @@
 
 import { useEffect, useMemo, useState } from "react";
 import { useRouter, useSearchParams } from "next/navigation";
-import { apiFetch } from "@/lib/api";
+import { apiFetchAll } from "@/lib/api";
 
 type Row = {
   id: string;
@@ -19,7 +19,7 @@ type Row = {
 };
 
 function fmtBD(x: number) {
-  return `${x.toFixed(2)} BD`;
+  return `${x.toFixed(3)} BD`;
 }
 
 export default function ExpensesClient() {
@@ -46,8 +46,7 @@ export default function ExpensesClient() {
       qs.set("month", month);
       if (categoryId) qs.set("categoryId", categoryId);
 
-      const data = await apiFetch<Row[]>(`/expenses?${qs.toString()}`);
-      setRows(Array.isArray(data) ? data : []);
+      setRows(await apiFetchAll<Row>(`/expenses?${qs.toString()}`));
     } catch (e: any) {
       setErr(e?.message || "Failed to load expenses");
     } finally {
@@ -16,7 +16,7 @@ function todayISO() {
 }
 
 function fmtBD(x: number) {
-  return `${x.toFixed(2)} BD`;
+  return `${x.toFixed(3)} BD`;
 }
 
 export default function NewExpensePage() {
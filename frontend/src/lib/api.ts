@@ -4,16 +4,55 @@ if (!API) {
   throw new Error("NEXT_PUBLIC_API_URL is not defined");
 }
 
+// CSRF token of the current session, sent back on every write.
+// Comes from /auth/login and /auth/me.
+let csrfToken: string | null = null;
+
+async function ensureCsrfToken(): Promise<string | null> {
+  if (!csrfToken) {
+    const res = await fetch(`${API}/auth/me`, { credentials: "include" });
+    if (res.ok) {
+      csrfToken = (await res.json())?.csrfToken ?? null;
+    }
+  }
+  return csrfToken;
+}
+
+async function requestError(res: Response): Promise<Error> {
+  let message = `Request failed: ${res.status}`;
+
+  if (res.headers.get("content-type")?.includes("application/json")) {
+    try {
+      const j = await res.json();
+      message = j?.error || message;
+    } catch {}
+  } else {
+    try {
+      const t = await res.text();
+      if (t) message = t;
+    } catch {}
+  }
+
+  const err: any = new Error(message);
+  err.status = res.status; // 👈 useful for redirects
+  return err;
+}
+
 export async function apiFetch<T = any>(
   path: string,
   options: RequestInit = {}
 ): Promise<T> {
+  const method = (options.method || "GET").toUpperCase();
+  const csrf =
+    method === "GET" || path === "/auth/login" ? null : await ensureCsrfToken();
+
   const res = await fetch(`${API}${path}`, {
     ...options,
     credentials: "include", // ✅ REQUIRED for cookies
     headers: {
       ...(options.headers || {}),
       "Content-Type": "application/json",
+      ...(csrf ? { "X-CSRF-Token": csrf } : {}),
     },
   });
 
@@ -22,30 +61,38 @@ export async function apiFetch<T = any>(
 
   // ❌ error handling
   if (!res.ok) {
-    let message = `Request failed: ${res.status}`;
-
-    if (isJSON) {
-      try {
-        const j = await res.json();
-        message = j?.error || message;
-      } catch {}
-    } else {
-      try {
-        const t = await res.text();
-        if (t) message = t;
-      } catch {}
-    }
-
-    const err: any = new Error(message);
-    err.status = res.status; // 👈 useful for redirects
-    throw err;
+    throw await requestError(res);
   }
 
   // ✅ success
   if (isJSON) {
-    return (await res.json()) as T;
+    const data = await res.json();
+    if (data?.csrfToken) csrfToken = data.csrfToken;
+    return data as T;
   }
 
   // backend may return empty body (204 / logout)
   return {} as T;
 }
+
+// GET every page of a paged list, following X-Next-Cursor.
+export async function apiFetchAll<T = any>(path: string): Promise<T[]> {
+  const out: T[] = [];
+  const sep = path.includes("?") ? "&" : "?";
+  let cursor = "";
+
+  do {
+    const page = `${path}${sep}limit=500${
+      cursor ? `&cursor=${encodeURIComponent(cursor)}` : ""
+    }`;
+    const res = await fetch(`${API}${page}`, { credentials: "include" });
+    if (!res.ok) {
+      throw await requestError(res);
+    }
+    const data = await res.json();
+    if (Array.isArray(data)) out.push(...data);
+    cursor = res.headers.get("X-Next-Cursor") || "";
+  } while (cursor);
+
+  return out;
+}